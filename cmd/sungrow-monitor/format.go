@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"sungrow-monitor/internal/inverter"
+	"sungrow-monitor/internal/storage"
+)
+
+// Output formats of the read command
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+	outputCSV   = "csv"
+)
+
+func checkOutputFormat(format string) error {
+	switch format {
+	case outputJSON, outputTable, outputCSV:
+		return nil
+	}
+	return fmt.Errorf("invalid output format %q (use json, table or csv)", format)
+}
+
+// formatData renders a reading for the terminal. The CSV columns match the
+// API export, so both can be fed to the same scripts.
+func formatData(data *inverter.InverterData, format string) (string, error) {
+	switch format {
+	case outputJSON:
+		output, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(output), nil
+	case outputTable:
+		return formatTable(data), nil
+	case outputCSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(storage.CSVHeader)
+		w.Write(storage.NewReading(data).CSVRecord())
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	}
+	return "", checkOutputFormat(format)
+}
+
+func formatTable(data *inverter.InverterData) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Inverter Info:\n")
+	fmt.Fprintf(&b, "  Model:         %s\n", data.Model)
+	fmt.Fprintf(&b, "  Serial Number: %s\n", data.SerialNumber)
+	fmt.Fprintf(&b, "  Device Type:   %d\n", data.DeviceTypeCode)
+	fmt.Fprintf(&b, "  Nominal Power: %.1f kW\n", data.NominalPower)
+	fmt.Fprintf(&b, "  Output Type:   %s\n", data.OutputType)
+	fmt.Fprintf(&b, "  Status:        %s\n", data.RunningStateString)
+	if data.FaultCode != 0 {
+		fmt.Fprintf(&b, "  Fault:         %d (%s)\n", data.FaultCode, data.FaultString)
+	}
+	fmt.Fprintf(&b, "\nCurrent Values:\n")
+	fmt.Fprintf(&b, "  Power:         %d W\n", data.TotalActivePower)
+	fmt.Fprintf(&b, "  DC Power:      %d W\n", data.TotalDCPower)
+	fmt.Fprintf(&b, "  MPPT1:         %.1f V / %.2f A / %d W\n", data.MPPT1Voltage, data.MPPT1Current, data.MPPT1Power)
+	fmt.Fprintf(&b, "  MPPT2:         %.1f V / %.2f A / %d W\n", data.MPPT2Voltage, data.MPPT2Current, data.MPPT2Power)
+	fmt.Fprintf(&b, "  Grid:          %.1f V / %.2f Hz\n", data.GridVoltage, data.GridFrequency)
+	fmt.Fprintf(&b, "  Daily Energy:  %.1f kWh\n", data.DailyEnergy)
+	fmt.Fprintf(&b, "  Total Energy:  %.1f kWh\n", data.TotalEnergy)
+	fmt.Fprintf(&b, "  Temperature:   %.1f °C", data.Temperature)
+	return b.String()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"sungrow-monitor/config"
+)
+
+// loadConfig loads the config file and sets up logging from it.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	setupLogging(cfg.Log)
+	return cfg, nil
+}
+
+// setupLogging sets the default logger: --verbose enables debug entries,
+// such as every collected reading. The text format keeps the standard
+// log line layout, the json format suits log collectors.
+func setupLogging(cfg config.LogConfig) {
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+
+	if cfg.Format == "json" {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: durationString,
+		})))
+		return
+	}
+	slog.SetLogLoggerLevel(level)
+}
+
+// durationString writes durations as "30s" rather than nanoseconds.
+func durationString(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindDuration {
+		return slog.String(a.Key, a.Value.Duration().String())
+	}
+	return a
+}
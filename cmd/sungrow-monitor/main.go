@@ -2,20 +2,28 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"sungrow-monitor/config"
+	"sungrow-monitor/internal/alerts"
 	"sungrow-monitor/internal/api"
+	"sungrow-monitor/internal/backup"
 	"sungrow-monitor/internal/collector"
+	"sungrow-monitor/internal/events"
+	"sungrow-monitor/internal/forecast"
 	"sungrow-monitor/internal/inverter"
 	"sungrow-monitor/internal/modbus"
 	"sungrow-monitor/internal/mqtt"
+	"sungrow-monitor/internal/notify"
 	"sungrow-monitor/internal/storage"
+	"sungrow-monitor/internal/sun"
 
 	"github.com/spf13/cobra"
 )
@@ -23,21 +31,26 @@ import (
 var (
 	configFile string
 	verbose    bool
+	direct     bool
+	output     string
 )
 
 func main() {
 	rootCmd := &cobra.Command{
 		Use:   "sungrow-monitor",
 		Short: "Sungrow inverter monitor",
-		Long:  "A tool to monitor Sungrow SG5.0RS-S inverter via Modbus TCP",
+		Long:  "A tool to monitor Sungrow inverters (SG5.0RS-S by default) via Modbus TCP",
 	}
 
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "config file path")
-	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "log debug messages, such as every reading collected")
+	rootCmd.PersistentFlags().BoolVar(&direct, "direct", false, "connect to the inverter directly even if a serve instance is running")
+	rootCmd.PersistentFlags().StringVarP(&output, "output", "o", outputJSON, "output format of read: json, table or csv")
 
 	rootCmd.AddCommand(serveCmd())
 	rootCmd.AddCommand(readCmd())
 	rootCmd.AddCommand(testCmd())
+	rootCmd.AddCommand(backfillCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -45,33 +58,112 @@ func main() {
 	}
 }
 
+func newModbusClient(cfg *config.Config) (*modbus.Client, error) {
+	wordOrder, err := modbus.ParseWordOrder(cfg.Inverter.WordOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	return modbus.NewClient(modbus.ClientConfig{
+		IP:      cfg.Inverter.IP,
+		Port:    cfg.Inverter.Port,
+		SlaveID: cfg.Inverter.SlaveID,
+		Timeout: cfg.Inverter.Timeout,
+
+		MaxRegistersPerRead: cfg.Inverter.MaxRegistersPerRead,
+		WordOrder:           wordOrder,
+		RetryCount:          cfg.Inverter.RetryCount,
+		RetryDelay:          cfg.Inverter.RetryDelay,
+	}), nil
+}
+
+// newRegisterMap returns the register map of the configured model with the
+// configured overrides applied.
+func newRegisterMap(cfg *config.Config) (inverter.RegisterMap, error) {
+	regs, err := inverter.RegisterMapForModel(cfg.Inverter.Model).WithOverrides(cfg.Inverter.Registers)
+	if err != nil {
+		return regs, fmt.Errorf("inverter.registers: %w", err)
+	}
+	return regs, nil
+}
+
+// newSite returns the configured site, or nil when it is not set.
+func newSite(cfg *config.Config) *sun.Site {
+	if !cfg.Site.Configured() {
+		return nil
+	}
+	return &sun.Site{Latitude: cfg.Site.Latitude, Longitude: cfg.Site.Longitude}
+}
+
+// newBackupJob builds the backup job for the configured target.
+func newBackupJob(cfg *config.Config, db *storage.Database) (*backup.Job, error) {
+	var target backup.Target
+	switch {
+	case cfg.Backup.S3.Bucket != "":
+		s3, err := backup.NewS3(backup.S3Config{
+			Endpoint:  cfg.Backup.S3.Endpoint,
+			Bucket:    cfg.Backup.S3.Bucket,
+			Region:    cfg.Backup.S3.Region,
+			AccessKey: cfg.Backup.S3.AccessKey,
+			SecretKey: cfg.Backup.S3.SecretKey,
+			Timeout:   cfg.Backup.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		target = s3
+	case cfg.Backup.WebDAV.URL != "":
+		target = backup.NewWebDAV(cfg.Backup.WebDAV.URL, cfg.Backup.WebDAV.Username, cfg.Backup.WebDAV.Password, cfg.Backup.Timeout)
+	default:
+		return nil, errors.New("backup is enabled but neither backup.s3.bucket nor backup.webdav.url is set")
+	}
+
+	return backup.NewJob(backup.JobConfig{
+		Database: db,
+		Target:   target,
+		Interval: cfg.Backup.Interval,
+		Format:   cfg.Backup.Format,
+		Prefix:   cfg.Backup.Prefix,
+	})
+}
+
+// sinkBuffer is how many readings an event sink may fall behind before it
+// starts missing them.
+const sinkBuffer = 64
+
+// serverShutdownTimeout bounds how long shutdown waits for in-flight API
+// requests; systemd's default stop timeout is 90s.
+const serverShutdownTimeout = 10 * time.Second
+
 func serveCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "serve",
 		Short: "Start the monitoring service",
 		Long:  "Start the collector, API server, and MQTT publisher",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Load(configFile)
+			cfg, err := loadConfig()
 			if err != nil {
-				return fmt.Errorf("failed to load config: %w", err)
+				return err
 			}
 
 			// Create Modbus client
-			modbusClient := modbus.NewClient(
-				cfg.Inverter.IP,
-				cfg.Inverter.Port,
-				cfg.Inverter.SlaveID,
-				cfg.Inverter.Timeout,
-			)
+			modbusClient, err := newModbusClient(cfg)
+			if err != nil {
+				return err
+			}
 
 			// Create database
 			db, err := storage.NewDatabase(cfg.Database.Path)
 			if err != nil {
 				return fmt.Errorf("failed to open database: %w", err)
 			}
-			log.Printf("Database opened at %s", cfg.Database.Path)
+			slog.Info("Database opened", "path", cfg.Database.Path)
 
-			// Create MQTT publisher
+			// Create MQTT publisher, with the topics of the inverter seen last
+			lastSerial := ""
+			if latest, err := db.GetLatestReading(); err == nil {
+				lastSerial = latest.SerialNumber
+			}
 			publisher, err := mqtt.NewPublisher(mqtt.PublisherConfig{
 				Broker:      cfg.MQTT.Broker,
 				ClientID:    cfg.MQTT.ClientID,
@@ -79,23 +171,90 @@ func serveCmd() *cobra.Command {
 				Password:    cfg.MQTT.Password,
 				TopicPrefix: cfg.MQTT.TopicPrefix,
 				Enabled:     cfg.MQTT.Enabled,
+				Model:       cfg.Inverter.Model,
+				InverterID:  cfg.Inverter.Name,
+				Serial:      lastSerial,
+
+				StatusFormat:     cfg.MQTT.StatusFormat,
+				ChangesOnly:      cfg.MQTT.PublishChangesOnly,
+				ChangeThresholds: cfg.MQTT.ChangeThresholds,
+				FullStatus:       cfg.MQTT.PublishFullStatus,
+				Individual:       cfg.MQTT.PublishIndividual,
+				Availability:     true,
 			})
 			if err != nil {
-				log.Printf("Warning: MQTT connection failed: %v", err)
+				slog.Warn("MQTT connection failed", "err", err)
 			} else if cfg.MQTT.Enabled {
-				log.Printf("MQTT connected to %s", cfg.MQTT.Broker)
-				// Publish Home Assistant discovery
-				publisher.PublishHomeAssistantDiscovery()
-			}
-
-			// Create collector
-			coll := collector.NewCollector(collector.CollectorConfig{
-				Client:    modbusClient,
-				Database:  db,
-				Publisher: publisher,
-				Interval:  cfg.Collector.Interval,
-				Enabled:   cfg.Collector.Enabled,
-			})
+				// Home Assistant discovery is published with the first
+				// reading, once the inverter model is known
+				slog.Info("MQTT connected", "broker", cfg.MQTT.Broker)
+			}
+
+			// Create alert rules and their notifier
+			var notifier notify.Notifier
+			if cfg.Alerts.WebhookURL != "" {
+				notifier = notify.NewWebhook(cfg.Alerts.WebhookURL, cfg.Alerts.WebhookTimeout)
+			}
+			var rules []alerts.Rule
+			if cfg.Alerts.PeakPower.Threshold > 0 {
+				rules = append(rules, &alerts.PeakPower{
+					Threshold: cfg.Alerts.PeakPower.Threshold,
+					Debounce:  cfg.Alerts.PeakPower.Debounce,
+				})
+			}
+			for i, rule := range cfg.Alerts.Rules {
+				threshold := alerts.ThresholdConfig{
+					Name:      rule.Name,
+					Metric:    rule.Metric,
+					Operator:  rule.Operator,
+					Threshold: rule.Threshold,
+					For:       rule.For,
+				}
+				if rule.DaylightOnly {
+					threshold.Site = newSite(cfg)
+				}
+				r, err := alerts.NewThreshold(threshold)
+				if err != nil {
+					return fmt.Errorf("alerts.rules[%d]: %w", i, err)
+				}
+				rules = append(rules, r)
+			}
+
+			// Create collector; storage, MQTT and alerts consume its events
+			regs, err := newRegisterMap(cfg)
+			if err != nil {
+				return err
+			}
+			bus := events.NewBus()
+			collectorCfg := collector.CollectorConfig{
+				Client:   modbusClient,
+				Interval: cfg.Collector.Interval,
+				Enabled:  cfg.Collector.Enabled,
+				Model:    cfg.Inverter.Model,
+				Fields:   cfg.Inverter.Fields,
+				Bus:      bus,
+				Energy:   db,
+
+				Registers: regs,
+
+				AsleepInterval:    cfg.Collector.AsleepInterval,
+				OfflineBackoff:    cfg.Collector.OfflineBackoff,
+				OfflineMaxBackoff: cfg.Collector.OfflineMaxBackoff,
+
+				AlignTimestamps: cfg.Collector.AlignTimestamps,
+				NightInterval:   cfg.Collector.NightInterval,
+
+				MaxConsecutiveFailures: cfg.Inverter.MaxConsecutiveFailures,
+
+				Location: cfg.Location(),
+			}
+			if cfg.Collector.DaylightOnly {
+				collectorCfg.Daylight = newSite(cfg)
+			}
+			coll, err := collector.NewCollector(collectorCfg)
+			if err != nil {
+				return fmt.Errorf("failed to create collector: %w", err)
+			}
 
 			// Setup context for graceful shutdown
 			ctx, cancel := context.WithCancel(context.Background())
@@ -105,36 +264,120 @@ func serveCmd() *cobra.Command {
 			sigChan := make(chan os.Signal, 1)
 			signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+			// Start the event sinks
+			var sinks sync.WaitGroup
+			runSink := func(name string, run func(context.Context, *events.Subscription)) {
+				sub := bus.Subscribe(name, sinkBuffer)
+				sinks.Add(1)
+				go func() {
+					defer sinks.Done()
+					run(ctx, sub)
+				}()
+			}
+			runSink("storage", db.StoreReadings)
+			if publisher != nil && publisher.IsEnabled() {
+				runSink("mqtt", mqtt.NewSink(mqtt.SinkConfig{
+					Publisher:          publisher,
+					Database:           db,
+					ProducingThreshold: cfg.Stats.ProducingThreshold,
+					Location:           cfg.Location(),
+				}).Run)
+			}
+			if len(rules) > 0 {
+				runSink("alerts", alerts.NewEngine(rules, notifier).Run)
+			}
+
 			// Start collector in goroutine
 			go func() {
 				if err := coll.Start(ctx); err != nil {
-					log.Printf("Collector error: %v", err)
+					slog.Error("Collector stopped with an error", "err", err)
 				}
 			}()
 
+			// Delete readings past the retention period
+			if cfg.Database.Retention > 0 {
+				go db.EnforceRetention(ctx, cfg.Database.Retention)
+			}
+
+			// Start the off-device backup if enabled
+			if cfg.Backup.Enabled {
+				job, err := newBackupJob(cfg, db)
+				if err != nil {
+					return fmt.Errorf("failed to set up backup: %w", err)
+				}
+				go job.Start(ctx)
+			}
+
 			// Start API server if enabled
+			var server *api.Server
 			if cfg.API.Enabled {
-				server := api.NewServer(api.ServerConfig{
+				server = api.NewServer(api.ServerConfig{
 					Port:      cfg.API.Port,
 					Collector: coll,
 					Database:  db,
-					WebPath:   cfg.API.WebPath,
+					Publisher: publisher,
+					Forecast: forecast.NewForecaster(forecast.Config{
+						Source:   db,
+						Days:     cfg.Forecast.Days,
+						Bucket:   cfg.Forecast.Bucket,
+						HalfLife: cfg.Forecast.HalfLife,
+
+						MinSamples: cfg.Forecast.MinSamples,
+					}),
+					WebPath: cfg.API.WebPath,
+					Model:   cfg.Inverter.Model,
+
+					ProducingThreshold: cfg.Stats.ProducingThreshold,
+					MinSamples:         cfg.Forecast.MinSamples,
+					ForecastDays:       cfg.Forecast.Days,
+					ForecastBucket:     cfg.Forecast.Bucket,
+					BackfillDelay:      cfg.MQTT.BackfillDelay,
+					StaleAfter:         cfg.API.StaleAfter,
+					StaticMaxAge:       cfg.API.StaticMaxAge,
+					RequestTimeout:     cfg.API.RequestTimeout,
+
+					MaxWebSocketClients: cfg.API.MaxWebSocketClients,
+					AuthToken:           cfg.API.AuthToken,
+					TLSCert:             cfg.API.TLSCert,
+					TLSKey:              cfg.API.TLSKey,
+					Location:            cfg.Location(),
+					Config:              cfg,
+					AllowWrites:         cfg.Inverter.AllowWrites,
 				})
+				if cfg.Inverter.AllowWrites && cfg.API.AuthToken == "" {
+					slog.Warn("inverter.allow_writes is on without api.auth_token: the power limit endpoint is disabled")
+				}
+				if cfg.API.AuthToken == "" {
+					slog.Warn("api.auth_token is not set: the API is open to anyone on the network and the maintenance endpoints are disabled")
+				}
 
 				go func() {
 					if err := server.Start(); err != nil {
-						log.Printf("API server error: %v", err)
+						slog.Error("API server stopped with an error", "err", err)
 					}
 				}()
 			}
 
-			log.Println("Sungrow Monitor started. Press Ctrl+C to stop.")
+			slog.Info("Sungrow Monitor started. Press Ctrl+C to stop.")
 
 			// Wait for signal
 			<-sigChan
-			log.Println("Shutting down...")
+			slog.Info("Shutting down...")
+			// Let in-flight requests finish before their data sources close
+			if server != nil {
+				shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), serverShutdownTimeout)
+				if err := server.Stop(shutdownCtx); err != nil {
+					slog.Warn("API server shutdown", "err", err)
+				}
+				cancelShutdown()
+			}
 			cancel()
 			coll.Stop()
+			sinks.Wait()
+			if publisher != nil {
+				publisher.Close()
+			}
+			db.Close()
 
 			return nil
 		},
@@ -147,58 +390,104 @@ func readCmd() *cobra.Command {
 		Short: "Read data once from the inverter",
 		Long:  "Connect to the inverter and read all data once",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Load(configFile)
+			cfg, err := loadConfig()
 			if err != nil {
-				return fmt.Errorf("failed to load config: %w", err)
+				return err
+			}
+			if err := checkOutputFormat(output); err != nil {
+				return err
+			}
+
+			if !direct {
+				data, err := readFromRunningInstance(cfg)
+				if err == nil {
+					return printData(data, output)
+				}
+				if !errors.Is(err, errNoRunningInstance) {
+					return fmt.Errorf("%w (use --direct to bypass the running instance)", err)
+				}
 			}
 
-			client := modbus.NewClient(
-				cfg.Inverter.IP,
-				cfg.Inverter.Port,
-				cfg.Inverter.SlaveID,
-				cfg.Inverter.Timeout,
-			)
+			client, err := newModbusClient(cfg)
+			if err != nil {
+				return err
+			}
 
 			if err := client.Connect(); err != nil {
 				return fmt.Errorf("failed to connect: %w", err)
 			}
 			defer client.Close()
 
-			sungrow := inverter.NewSungrow(client)
+			regs, err := newRegisterMap(cfg)
+			if err != nil {
+				return err
+			}
+			sungrow, err := inverter.NewSungrow(client, cfg.Inverter.Model, cfg.Inverter.Fields, regs)
+			if err != nil {
+				return err
+			}
 			data, err := sungrow.ReadAllData()
 			if err != nil {
 				return fmt.Errorf("failed to read data: %w", err)
 			}
 
-			output, _ := json.MarshalIndent(data, "", "  ")
-			fmt.Println(string(output))
-
-			return nil
+			return printData(data, output)
 		},
 	}
 }
 
+// printData writes data to stdout in the given output format.
+func printData(data *inverter.InverterData, format string) error {
+	text, err := formatData(data, format)
+	if err != nil {
+		return err
+	}
+	fmt.Println(text)
+	return nil
+}
+
 func testCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "test",
 		Short: "Test connection to the inverter",
 		Long:  "Test the Modbus TCP connection to the inverter",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Load(configFile)
+			cfg, err := loadConfig()
 			if err != nil {
-				return fmt.Errorf("failed to load config: %w", err)
+				return err
+			}
+
+			if !direct {
+				data, err := readFromRunningInstance(cfg)
+				if err == nil {
+					fmt.Printf("A serve instance is running on port %d; reporting its latest data.\n", cfg.API.Port)
+					fmt.Printf("  Online:        %t\n", data.IsOnline)
+					fmt.Printf("  Serial Number: %s\n", data.SerialNumber)
+					fmt.Printf("  Status:        %s\n", data.RunningStateString)
+					fmt.Printf("  Power:         %d W\n", data.TotalActivePower)
+					fmt.Printf("  Last Reading:  %s\n", data.Timestamp.Format(time.RFC3339))
+					return nil
+				}
+				if !errors.Is(err, errNoRunningInstance) {
+					return fmt.Errorf("%w (use --direct to bypass the running instance)", err)
+				}
 			}
 
 			fmt.Printf("Testing connection to %s:%d...\n", cfg.Inverter.IP, cfg.Inverter.Port)
 
-			client := modbus.NewClient(
-				cfg.Inverter.IP,
-				cfg.Inverter.Port,
-				cfg.Inverter.SlaveID,
-				cfg.Inverter.Timeout,
-			)
+			client, err := newModbusClient(cfg)
+			if err != nil {
+				return err
+			}
 
-			sungrow := inverter.NewSungrow(client)
+			regs, err := newRegisterMap(cfg)
+			if err != nil {
+				return err
+			}
+			sungrow, err := inverter.NewSungrow(client, cfg.Inverter.Model, cfg.Inverter.Fields, regs)
+			if err != nil {
+				return err
+			}
 			if err := sungrow.TestConnection(); err != nil {
 				fmt.Printf("Connection FAILED: %v\n", err)
 				return err
@@ -211,17 +500,29 @@ func testCmd() *cobra.Command {
 			if err != nil {
 				fmt.Printf("Warning: Could not read data: %v\n", err)
 			} else {
-				fmt.Printf("\nInverter Info:\n")
-				fmt.Printf("  Serial Number: %s\n", data.SerialNumber)
-				fmt.Printf("  Device Type:   %d\n", data.DeviceTypeCode)
-				fmt.Printf("  Nominal Power: %.1f kW\n", data.NominalPower)
-				fmt.Printf("  Output Type:   %s\n", data.OutputType)
-				fmt.Printf("  Status:        %s\n", data.RunningStateString)
-				fmt.Printf("\nCurrent Values:\n")
-				fmt.Printf("  Power:         %d W\n", data.TotalActivePower)
-				fmt.Printf("  Daily Energy:  %.1f kWh\n", data.DailyEnergy)
-				fmt.Printf("  Total Energy:  %.1f kWh\n", data.TotalEnergy)
-				fmt.Printf("  Temperature:   %.1f °C\n", data.Temperature)
+				fmt.Println()
+				printData(data, outputTable)
+				// A wildly wrong total usually means the wrong word order
+				if regs.TotalEnergy != 0 {
+					if words, err := client.ReadBlock(regs.TotalEnergy, 2); err == nil {
+						other := modbus.WordOrderHighLow
+						if client.WordOrder() == modbus.WordOrderHighLow {
+							other = modbus.WordOrderLowHigh
+						}
+						fmt.Printf("  Word Order:    %s (as %s the total would be %.1f kWh)\n",
+							client.WordOrder(), other, float64(other.Uint32(words))*0.1)
+					}
+				}
+			}
+			// A register counts as unsupported only after repeated
+			// exceptions, so read a few more times before listing them
+			if err == nil {
+				for i := 1; i < modbus.ExceptionsBeforeUnsupported; i++ {
+					sungrow.ReadAllData()
+				}
+			}
+			if unsupported := client.UnsupportedRegisters(); len(unsupported) > 0 {
+				fmt.Printf("  Unsupported:   %v (registers the inverter kept refusing; not read again until it reconnects)\n", unsupported)
 			}
 
 			client.Close()
@@ -229,3 +530,89 @@ func testCmd() *cobra.Command {
 		},
 	}
 }
+
+func backfillCmd() *cobra.Command {
+	var fromStr, toStr string
+	var delay time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "backfill",
+		Short: "Republish stored readings to MQTT",
+		Long:  "Republish a range of stored readings on the MQTT topics so subscribers can recover missed data",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			from, err := time.Parse(time.RFC3339, fromStr)
+			if err != nil {
+				return fmt.Errorf("invalid --from: %w", err)
+			}
+			to, err := time.Parse(time.RFC3339, toStr)
+			if err != nil {
+				return fmt.Errorf("invalid --to: %w", err)
+			}
+			if !cmd.Flags().Changed("delay") {
+				delay = cfg.MQTT.BackfillDelay
+			}
+
+			db, err := storage.NewDatabase(cfg.Database.Path)
+			if err != nil {
+				return fmt.Errorf("failed to open database: %w", err)
+			}
+			defer db.Close()
+
+			readings, err := db.GetReadingsByRange(from, to)
+			if err != nil {
+				return fmt.Errorf("failed to load readings: %w", err)
+			}
+
+			// Publish under the topics of the newest reading
+			lastSerial := ""
+			if len(readings) > 0 {
+				lastSerial = readings[0].SerialNumber
+			}
+
+			// Use a distinct client ID so a running serve instance keeps
+			// its own session
+			publisher, err := mqtt.NewPublisher(mqtt.PublisherConfig{
+				Broker:      cfg.MQTT.Broker,
+				ClientID:    cfg.MQTT.ClientID + "-backfill",
+				Username:    cfg.MQTT.Username,
+				Password:    cfg.MQTT.Password,
+				TopicPrefix: cfg.MQTT.TopicPrefix,
+				Enabled:     true,
+				Model:       cfg.Inverter.Model,
+				InverterID:  cfg.Inverter.Name,
+				Serial:      lastSerial,
+
+				StatusFormat: cfg.MQTT.StatusFormat,
+				FullStatus:   cfg.MQTT.PublishFullStatus,
+				Individual:   cfg.MQTT.PublishIndividual,
+			})
+			if err != nil {
+				return err
+			}
+			defer publisher.Close()
+
+			history := make([]*inverter.InverterData, 0, len(readings))
+			for i := len(readings) - 1; i >= 0; i-- {
+				history = append(history, readings[i].ToInverterData())
+			}
+
+			fmt.Printf("Republishing %d readings with %s between messages...\n", len(history), delay)
+			sent, err := publisher.Republish(cmd.Context(), history, delay)
+			fmt.Printf("Republished %d readings\n", sent)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&fromStr, "from", "", "start of the range (RFC3339)")
+	cmd.Flags().StringVar(&toStr, "to", "", "end of the range (RFC3339)")
+	cmd.Flags().DurationVar(&delay, "delay", 0, "pause between readings (defaults to mqtt.backfill_delay)")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
+
+	return cmd
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sungrow-monitor/config"
+	"sungrow-monitor/internal/inverter"
+)
+
+// errNoRunningInstance means no serve process answered on the API port, so
+// it is safe to open a Modbus connection directly.
+var errNoRunningInstance = errors.New("no running instance")
+
+const proxyTimeout = 2 * time.Second
+
+// readFromRunningInstance fetches the latest data from a running serve
+// process. The inverter dongle accepts a single Modbus client, so opening a
+// second connection next to the collector would break it.
+func readFromRunningInstance(cfg *config.Config) (*inverter.InverterData, error) {
+	if !cfg.API.Enabled {
+		return nil, errNoRunningInstance
+	}
+
+	client := &http.Client{Timeout: proxyTimeout}
+	baseURL := fmt.Sprintf("http://127.0.0.1:%d", cfg.API.Port)
+	if cfg.API.TLSCert != "" && cfg.API.TLSKey != "" {
+		// The certificate names the public host, not the loopback address
+		// used here, so it cannot be verified against it
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		baseURL = fmt.Sprintf("https://127.0.0.1:%d", cfg.API.Port)
+	}
+
+	var health struct {
+		Collecting bool `json:"collecting"`
+	}
+	resp, err := client.Get(baseURL + "/health")
+	if err != nil {
+		return nil, errNoRunningInstance
+	}
+	err = json.NewDecoder(resp.Body).Decode(&health)
+	resp.Body.Close()
+	if err != nil || !health.Collecting {
+		return nil, errNoRunningInstance
+	}
+
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/api/v1/status", nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.API.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.API.AuthToken)
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("running instance did not answer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("running instance has no data yet (HTTP %d)", resp.StatusCode)
+	}
+
+	var data inverter.InverterData
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode status from running instance: %w", err)
+	}
+	return &data, nil
+}
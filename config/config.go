@@ -12,24 +12,127 @@ type Config struct {
 	API       APIConfig       `mapstructure:"api"`
 	MQTT      MQTTConfig      `mapstructure:"mqtt"`
 	Database  DatabaseConfig  `mapstructure:"database"`
+	Stats     StatsConfig     `mapstructure:"stats"`
+	Forecast  ForecastConfig  `mapstructure:"forecast"`
+	Alerts    AlertsConfig    `mapstructure:"alerts"`
+	Backup    BackupConfig    `mapstructure:"backup"`
+	Log       LogConfig       `mapstructure:"log"`
+
+	// Timezone is the IANA name (e.g. America/Sao_Paulo) that decides where
+	// days and hours start; empty uses the system's local time.
+	Timezone string `mapstructure:"timezone"`
+
+	// Site locates the panels so sunrise and sunset can be computed.
+	Site SiteConfig `mapstructure:"site"`
+}
+
+// SiteConfig holds the installation's coordinates in decimal degrees, north
+// and east positive; both zero means they are not configured.
+type SiteConfig struct {
+	Latitude  float64 `mapstructure:"latitude"`
+	Longitude float64 `mapstructure:"longitude"`
+}
+
+// Configured reports whether the coordinates are set.
+func (s SiteConfig) Configured() bool {
+	return s.Latitude != 0 || s.Longitude != 0
+}
+
+// Location returns the configured timezone, or time.Local when it is unset
+// or invalid (Validate reports the latter).
+func (c *Config) Location() *time.Location {
+	if c.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
 }
 
 type InverterConfig struct {
+	// Model names the inverter in discovery and the dashboard, and in MQTT
+	// topics until the serial is known.
+	Model string `mapstructure:"model"`
+	// Name identifies this inverter in MQTT topics and Home Assistant
+	// discovery; empty uses the serial.
+	Name string `mapstructure:"name"`
+
 	IP      string        `mapstructure:"ip"`
 	Port    int           `mapstructure:"port"`
 	SlaveID uint8         `mapstructure:"slave_id"`
 	Timeout time.Duration `mapstructure:"timeout"`
+
+	// MaxRegistersPerRead caps a single Modbus read; some dongles reject
+	// larger requests.
+	MaxRegistersPerRead uint16 `mapstructure:"max_registers_per_read"`
+	// WordOrder is the register order of 32-bit values: "lowhigh" or
+	// "highlow".
+	WordOrder string `mapstructure:"word_order"`
+
+	// RetryCount is how many more times a failed snapshot read is tried,
+	// RetryDelay apart, before the inverter counts as offline.
+	RetryCount int           `mapstructure:"retry_count"`
+	RetryDelay time.Duration `mapstructure:"retry_delay"`
+
+	// MaxConsecutiveFailures is how many failed cycles in a row force a
+	// reconnect even though the connection still looks open.
+	MaxConsecutiveFailures int `mapstructure:"max_consecutive_failures"`
+
+	// Fields selects the register groups read every cycle (device_info,
+	// energy, mppt, grid, power, status); empty reads all of them.
+	Fields []string `mapstructure:"fields"`
+
+	// Registers overrides addresses of the register map chosen by Model,
+	// keyed by register name (e.g. total_active_power); 0 unmaps one.
+	Registers map[string]uint16 `mapstructure:"registers"`
+
+	// AllowWrites enables the API endpoints that change inverter settings,
+	// such as the power limit. Off by default.
+	AllowWrites bool `mapstructure:"allow_writes"`
 }
 
 type CollectorConfig struct {
 	Interval time.Duration `mapstructure:"interval"`
 	Enabled  bool          `mapstructure:"enabled"`
+
+	// AsleepInterval replaces Interval while the inverter is in standby.
+	AsleepInterval time.Duration `mapstructure:"asleep_interval"`
+	// OfflineBackoff is the first retry delay once the inverter stops
+	// answering, doubled on each failure up to OfflineMaxBackoff.
+	OfflineBackoff    time.Duration `mapstructure:"offline_backoff"`
+	OfflineMaxBackoff time.Duration `mapstructure:"offline_max_backoff"`
+
+	// AlignTimestamps rounds reading timestamps to the nearest multiple of
+	// Interval so they fall on a clean time grid.
+	AlignTimestamps bool `mapstructure:"align_timestamps"`
+
+	// DaylightOnly polls only every NightInterval between sunset and
+	// sunrise at the configured site.
+	DaylightOnly  bool          `mapstructure:"daylight_only"`
+	NightInterval time.Duration `mapstructure:"night_interval"`
 }
 
 type APIConfig struct {
 	Port    int    `mapstructure:"port"`
 	Enabled bool   `mapstructure:"enabled"`
 	WebPath string `mapstructure:"web_path"`
+
+	// StaleAfter is the reading age after which the status is flagged stale.
+	StaleAfter time.Duration `mapstructure:"stale_after"`
+	// StaticMaxAge is the browser cache lifetime of /static assets.
+	StaticMaxAge time.Duration `mapstructure:"static_max_age"`
+	// RequestTimeout bounds each API request, except streaming ones.
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	// MaxWebSocketClients caps concurrent live dashboard connections.
+	MaxWebSocketClients int `mapstructure:"max_websocket_clients"`
+	// AuthToken, when set, must be sent as a bearer token (or ?token=)
+	// to /api/v1 and /metrics. The pages and /health stay open.
+	AuthToken string `mapstructure:"auth_token"`
+	// TLSCert and TLSKey, when both set, make the API serve HTTPS.
+	TLSCert string `mapstructure:"tls_cert"`
+	TLSKey  string `mapstructure:"tls_key"`
 }
 
 type MQTTConfig struct {
@@ -39,10 +142,99 @@ type MQTTConfig struct {
 	ClientID    string `mapstructure:"client_id"`
 	Username    string `mapstructure:"username"`
 	Password    string `mapstructure:"password"`
+
+	// BackfillDelay is the pause between readings when republishing history.
+	BackfillDelay time.Duration `mapstructure:"backfill_delay"`
+	// StatusFormat selects the status payload keys: "struct" or "topics".
+	StatusFormat string `mapstructure:"status_format"`
+	// PublishChangesOnly skips value topics that changed less than their
+	// threshold in ChangeThresholds (keyed by topic name).
+	PublishChangesOnly bool               `mapstructure:"publish_changes_only"`
+	ChangeThresholds   map[string]float64 `mapstructure:"change_thresholds"`
+	// PublishFullStatus and PublishIndividual gate the JSON status topic
+	// and the per-value topics.
+	PublishFullStatus bool `mapstructure:"publish_full_status"`
+	PublishIndividual bool `mapstructure:"publish_individual"`
 }
 
 type DatabaseConfig struct {
 	Path string `mapstructure:"path"`
+
+	// Retention is how long readings are kept, e.g. "90d"; zero keeps
+	// them forever.
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+type StatsConfig struct {
+	// ProducingThreshold is the AC power floor (W) above which the inverter
+	// counts as producing for the daily producing-time summary.
+	ProducingThreshold uint32 `mapstructure:"producing_threshold"`
+}
+
+type ForecastConfig struct {
+	Days     int           `mapstructure:"days"`
+	Bucket   time.Duration `mapstructure:"bucket"`
+	HalfLife time.Duration `mapstructure:"half_life"`
+	// MinSamples is the minimum number of readings behind a time-of-day
+	// average for it to be used.
+	MinSamples int64 `mapstructure:"min_samples"`
+}
+
+type AlertsConfig struct {
+	WebhookURL     string          `mapstructure:"webhook_url"`
+	WebhookTimeout time.Duration   `mapstructure:"webhook_timeout"`
+	PeakPower      PeakPowerConfig `mapstructure:"peak_power"`
+	Rules          []AlertRule     `mapstructure:"rules"`
+}
+
+// AlertRule fires an alert when Metric (named like the MQTT value topics)
+// compared with Threshold by Operator holds for For. DaylightOnly ignores
+// the night, as computed from Site.
+type AlertRule struct {
+	Name         string        `mapstructure:"name"`
+	Metric       string        `mapstructure:"metric"`
+	Operator     string        `mapstructure:"operator"`
+	Threshold    float64       `mapstructure:"threshold"`
+	For          time.Duration `mapstructure:"for"`
+	DaylightOnly bool          `mapstructure:"daylight_only"`
+}
+
+// PeakPowerConfig fires an alert when power stays above Threshold (W) for
+// longer than Debounce. A zero threshold disables it.
+type PeakPowerConfig struct {
+	Threshold uint32        `mapstructure:"threshold"`
+	Debounce  time.Duration `mapstructure:"debounce"`
+}
+
+// BackupConfig uploads the readings added since the previous run to an
+// S3-compatible bucket (when S3.Bucket is set) or a WebDAV collection.
+type BackupConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+	Format   string        `mapstructure:"format"`
+	Prefix   string        `mapstructure:"prefix"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	S3       S3Config      `mapstructure:"s3"`
+	WebDAV   WebDAVConfig  `mapstructure:"webdav"`
+}
+
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	Bucket    string `mapstructure:"bucket"`
+	Region    string `mapstructure:"region"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+}
+
+type WebDAVConfig struct {
+	URL      string `mapstructure:"url"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+type LogConfig struct {
+	// Format is "text" (one readable line per entry) or "json".
+	Format string `mapstructure:"format"`
 }
 
 func Load(configPath string) (*Config, error) {
@@ -56,20 +248,55 @@ func Load(configPath string) (*Config, error) {
 	}
 
 	// Set defaults
+	viper.SetDefault("inverter.model", "SG5.0RS-S")
 	viper.SetDefault("inverter.ip", "172.16.0.120")
 	viper.SetDefault("inverter.port", 502)
 	viper.SetDefault("inverter.slave_id", 1)
 	viper.SetDefault("inverter.timeout", "10s")
+	viper.SetDefault("inverter.max_registers_per_read", 64)
+	viper.SetDefault("inverter.word_order", "lowhigh")
+	viper.SetDefault("inverter.max_consecutive_failures", 3)
+	viper.SetDefault("inverter.retry_count", 1)
+	viper.SetDefault("inverter.retry_delay", "200ms")
+	viper.SetDefault("inverter.allow_writes", false)
 	viper.SetDefault("collector.interval", "30s")
 	viper.SetDefault("collector.enabled", true)
+	viper.SetDefault("collector.asleep_interval", "5m")
+	viper.SetDefault("collector.offline_backoff", "30s")
+	viper.SetDefault("collector.offline_max_backoff", "15m")
+	viper.SetDefault("collector.night_interval", "15m")
 	viper.SetDefault("api.port", 8080)
 	viper.SetDefault("api.enabled", true)
 	viper.SetDefault("api.web_path", "./web")
+	viper.SetDefault("api.stale_after", "90s")
+	viper.SetDefault("api.static_max_age", "1h")
+	viper.SetDefault("api.request_timeout", "30s")
+	viper.SetDefault("api.max_websocket_clients", 16)
 	viper.SetDefault("mqtt.enabled", true)
 	viper.SetDefault("mqtt.broker", "tcp://localhost:1883")
 	viper.SetDefault("mqtt.topic_prefix", "sungrow")
 	viper.SetDefault("mqtt.client_id", "sungrow-monitor")
+	viper.SetDefault("mqtt.backfill_delay", "100ms")
+	viper.SetDefault("mqtt.status_format", "struct")
+	viper.SetDefault("mqtt.publish_full_status", true)
+	viper.SetDefault("mqtt.publish_individual", true)
 	viper.SetDefault("database.path", "./sungrow.db")
+	viper.SetDefault("database.retention", "0")
+	viper.SetDefault("stats.producing_threshold", 50)
+	viper.SetDefault("forecast.days", 30)
+	viper.SetDefault("forecast.bucket", "15m")
+	viper.SetDefault("forecast.half_life", "30m")
+	viper.SetDefault("forecast.min_samples", 3)
+	viper.SetDefault("alerts.webhook_timeout", "10s")
+	viper.SetDefault("alerts.peak_power.debounce", "5m")
+	viper.SetDefault("backup.enabled", false)
+	viper.SetDefault("backup.interval", "24h")
+	viper.SetDefault("backup.format", "csv")
+	viper.SetDefault("backup.timeout", "5m")
+	viper.SetDefault("backup.s3.endpoint", "https://s3.amazonaws.com")
+	viper.SetDefault("backup.s3.region", "us-east-1")
+	viper.SetDefault("log.format", "text")
+	bindEnv()
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -78,7 +305,10 @@ func Load(configPath string) (*Config, error) {
 	}
 
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := viper.Unmarshal(&cfg, viper.DecodeHook(decodeHook)); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ParseDuration extends time.ParseDuration with a days suffix, so long
+// periods such as retention can be written as "90d".
+func ParseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err == nil {
+			return time.Duration(n * float64(24*time.Hour)), nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// decodeHook replaces viper's default decode hooks: it turns strings into
+// durations with ParseDuration and splits comma-separated strings into
+// slices, as viper does for environment variables.
+func decodeHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	s, ok := data.(string)
+	if !ok || from.Kind() != reflect.String {
+		return data, nil
+	}
+
+	switch {
+	case to == durationType:
+		return ParseDuration(s)
+	case to.Kind() == reflect.Slice:
+		if s == "" {
+			return []string{}, nil
+		}
+		return strings.Split(s, ","), nil
+	}
+	return data, nil
+}
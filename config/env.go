@@ -0,0 +1,60 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// envPrefix is prepended to the environment variable of every key, e.g.
+// SUNGROW_MQTT_BROKER for mqtt.broker.
+const envPrefix = "SUNGROW"
+
+// envAliases are shorter names accepted besides the derived ones.
+var envAliases = map[string][]string{
+	"database.path": {"SUNGROW_DB_PATH"},
+}
+
+// bindEnv lets environment variables override the config file. AutomaticEnv
+// alone only covers keys viper already knows from a default or the file, so
+// every key of Config is bound explicitly. Lists take comma-separated
+// values; maps and lists of tables (alerts.rules) can only come from the
+// file.
+func bindEnv() {
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	for _, key := range envKeys(reflect.TypeOf(Config{}), "") {
+		names := append([]string{envName(key)}, envAliases[key]...)
+		viper.BindEnv(append([]string{key}, names...)...)
+	}
+}
+
+// envName returns the environment variable for key.
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// envKeys lists the dotted keys of the scalar and list settings in t.
+func envKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		field := t.Field(i).Type
+
+		switch {
+		case field.Kind() == reflect.Struct:
+			keys = append(keys, envKeys(field, prefix+key+".")...)
+		case field.Kind() == reflect.Map, field.Kind() == reflect.Slice && field.Elem().Kind() == reflect.Struct:
+			// Only settable from the file
+		default:
+			keys = append(keys, prefix+key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"reflect"
+	"time"
+)
+
+// redactedValue replaces secrets in Redacted.
+const redactedValue = "***"
+
+// secretKeys are the settings Redacted hides, by their dotted YAML path.
+var secretKeys = map[string]bool{
+	"mqtt.password":          true,
+	"api.auth_token":         true,
+	"alerts.webhook_url":     true,
+	"backup.s3.secret_key":   true,
+	"backup.webdav.password": true,
+}
+
+// Redacted returns the config keyed like the YAML file, with durations
+// written as strings and secrets replaced by "***". Unset secrets stay
+// empty so it still shows whether they were configured.
+func (c *Config) Redacted() map[string]interface{} {
+	return redactStruct(reflect.ValueOf(*c), "")
+}
+
+func redactStruct(v reflect.Value, prefix string) map[string]interface{} {
+	out := make(map[string]interface{}, v.NumField())
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		path := prefix + key
+		field := v.Field(i)
+
+		switch {
+		case secretKeys[path]:
+			if field.String() != "" {
+				out[key] = redactedValue
+			} else {
+				out[key] = ""
+			}
+		case field.Type() == reflect.TypeOf(time.Duration(0)):
+			out[key] = time.Duration(field.Int()).String()
+		case field.Kind() == reflect.Struct:
+			out[key] = redactStruct(field, path+".")
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			items := make([]map[string]interface{}, field.Len())
+			for j := range items {
+				items[j] = redactStruct(field.Index(j), path+".")
+			}
+			out[key] = items
+		default:
+			out[key] = field.Interface()
+		}
+	}
+	return out
+}
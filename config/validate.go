@@ -0,0 +1,131 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// hostnamePattern accepts DNS names, for dongles reached by name instead
+// of by address.
+var hostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// Validate checks the settings that otherwise only fail later with an
+// obscure connection or I/O error. Every problem is reported, each naming
+// its config key.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	switch {
+	case c.Inverter.IP == "":
+		fail("inverter.ip", "must be set to the address of the inverter or its dongle")
+	case net.ParseIP(c.Inverter.IP) == nil && !hostnamePattern.MatchString(c.Inverter.IP):
+		fail("inverter.ip", "%q is neither an IP address nor a hostname", c.Inverter.IP)
+	}
+	if c.Inverter.Port < 1 || c.Inverter.Port > 65535 {
+		fail("inverter.port", "%d is outside 1-65535", c.Inverter.Port)
+	}
+	if c.Inverter.Timeout <= 0 {
+		fail("inverter.timeout", "must be positive, got %s", c.Inverter.Timeout)
+	}
+	if c.Inverter.MaxConsecutiveFailures < 1 {
+		fail("inverter.max_consecutive_failures", "must be at least 1, got %d", c.Inverter.MaxConsecutiveFailures)
+	}
+	if c.Collector.Interval <= 0 {
+		fail("collector.interval", "must be positive, got %s", c.Collector.Interval)
+	}
+	if c.API.Enabled && (c.API.Port < 1 || c.API.Port > 65535) {
+		fail("api.port", "%d is outside 1-65535", c.API.Port)
+	}
+	if c.API.Enabled && (c.API.TLSCert != "" || c.API.TLSKey != "") {
+		switch {
+		case c.API.TLSCert == "":
+			fail("api.tls_cert", "must be set together with api.tls_key")
+		case c.API.TLSKey == "":
+			fail("api.tls_key", "must be set together with api.tls_cert")
+		default:
+			if _, err := tls.LoadX509KeyPair(c.API.TLSCert, c.API.TLSKey); err != nil {
+				fail("api.tls_cert", "%v", err)
+			}
+		}
+	}
+	if c.MQTT.Enabled && c.MQTT.Broker == "" {
+		fail("mqtt.broker", "must be set when mqtt.enabled is true")
+	}
+	if c.MQTT.Enabled && !c.MQTT.PublishFullStatus && !c.MQTT.PublishIndividual {
+		fail("mqtt.publish_individual", "must be true when mqtt.publish_full_status is false, or nothing is published")
+	}
+	if c.Database.Retention < 0 {
+		fail("database.retention", "must not be negative, got %s", c.Database.Retention)
+	}
+	if err := checkWritableDir(filepath.Dir(c.Database.Path)); err != nil {
+		fail("database.path", "%v", err)
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			fail("timezone", "%v", err)
+		}
+	}
+	if c.Site.Latitude < -90 || c.Site.Latitude > 90 {
+		fail("site.latitude", "%g is outside -90 to 90", c.Site.Latitude)
+	}
+	if c.Site.Longitude < -180 || c.Site.Longitude > 180 {
+		fail("site.longitude", "%g is outside -180 to 180", c.Site.Longitude)
+	}
+	if c.Collector.DaylightOnly && !c.Site.Configured() {
+		fail("collector.daylight_only", "needs site.latitude and site.longitude")
+	}
+	for i, rule := range c.Alerts.Rules {
+		if rule.DaylightOnly && !c.Site.Configured() {
+			fail(fmt.Sprintf("alerts.rules[%d].daylight_only", i), "needs site.latitude and site.longitude")
+		}
+	}
+	switch {
+	case c.Forecast.Bucket <= 0 || c.Forecast.Bucket > 24*time.Hour:
+		fail("forecast.bucket", "must be between 0 and 24h, got %s", c.Forecast.Bucket)
+	case (24*time.Hour)%c.Forecast.Bucket != 0:
+		fail("forecast.bucket", "%s does not divide a day evenly", c.Forecast.Bucket)
+	}
+	if c.Forecast.Days <= 0 {
+		fail("forecast.days", "must be positive, got %d", c.Forecast.Days)
+	}
+	if c.Forecast.HalfLife <= 0 {
+		fail("forecast.half_life", "must be positive, got %s", c.Forecast.HalfLife)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		fail("log.format", "%q is neither \"text\" nor \"json\"", c.Log.Format)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// checkWritableDir makes sure a file can be created in dir, which SQLite
+// needs for the database and its journal.
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("directory %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	f, err := os.CreateTemp(dir, ".sungrow-monitor-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable: %w", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
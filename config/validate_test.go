@@ -0,0 +1,61 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns a config that passes Validate.
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	c := &Config{}
+	c.Inverter.IP = "192.168.1.50"
+	c.Inverter.Port = 502
+	c.Inverter.Timeout = 5 * time.Second
+	c.Inverter.MaxConsecutiveFailures = 3
+	c.Collector.Interval = time.Minute
+	c.Database.Path = filepath.Join(t.TempDir(), "sungrow.db")
+	c.Log.Format = "text"
+	c.Forecast.Days = 30
+	c.Forecast.Bucket = 15 * time.Minute
+	c.Forecast.HalfLife = 30 * time.Minute
+	return c
+}
+
+func TestValidateForecast(t *testing.T) {
+	if err := validConfig(t).Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		set  func(*Config)
+		key  string
+	}{
+		{"zero bucket", func(c *Config) { c.Forecast.Bucket = 0 }, "forecast.bucket"},
+		{"negative bucket", func(c *Config) { c.Forecast.Bucket = -time.Minute }, "forecast.bucket"},
+		{"bucket over a day", func(c *Config) { c.Forecast.Bucket = 25 * time.Hour }, "forecast.bucket"},
+		{"bucket not dividing a day", func(c *Config) { c.Forecast.Bucket = 7 * time.Minute }, "forecast.bucket"},
+		{"zero days", func(c *Config) { c.Forecast.Days = 0 }, "forecast.days"},
+		{"zero half-life", func(c *Config) { c.Forecast.HalfLife = 0 }, "forecast.half_life"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig(t)
+			tt.set(c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.key+":") {
+				t.Errorf("Validate = %v, want an error for %s", err, tt.key)
+			}
+		})
+	}
+
+	c := validConfig(t)
+	c.Forecast.Bucket = 24 * time.Hour
+	if err := c.Validate(); err != nil {
+		t.Errorf("a one-day bucket: %v", err)
+	}
+}
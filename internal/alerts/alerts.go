@@ -0,0 +1,108 @@
+// Package alerts evaluates monitoring rules against live readings and
+// produces notification events.
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"sungrow-monitor/internal/events"
+	"sungrow-monitor/internal/inverter"
+	"sungrow-monitor/internal/notify"
+)
+
+// Rule inspects each reading and returns an event when it fires.
+type Rule interface {
+	Evaluate(data *inverter.InverterData) *notify.Event
+}
+
+// PeakPower fires once when active power stays above Threshold for longer
+// than Debounce, e.g. to warn about demand charges. It re-arms when power
+// drops back under the threshold.
+type PeakPower struct {
+	Threshold uint32
+	Debounce  time.Duration
+
+	aboveSince time.Time
+	peak       uint32
+	fired      bool
+}
+
+func (r *PeakPower) Evaluate(data *inverter.InverterData) *notify.Event {
+	if !data.IsOnline || data.TotalActivePower <= r.Threshold {
+		r.aboveSince = time.Time{}
+		r.peak = 0
+		r.fired = false
+		return nil
+	}
+
+	if r.aboveSince.IsZero() {
+		r.aboveSince = data.Timestamp
+	}
+	if data.TotalActivePower > r.peak {
+		r.peak = data.TotalActivePower
+	}
+
+	sustained := data.Timestamp.Sub(r.aboveSince)
+	if r.fired || sustained < r.Debounce {
+		return nil
+	}
+	r.fired = true
+
+	return &notify.Event{
+		Type:      "peak_power",
+		Message:   fmt.Sprintf("Power above %dW for %s (peak %dW)", r.Threshold, sustained.Round(time.Second), r.peak),
+		Timestamp: data.Timestamp,
+		Data: map[string]interface{}{
+			"threshold_w":       r.Threshold,
+			"peak_w":            r.peak,
+			"sustained_seconds": sustained.Seconds(),
+			"since":             r.aboveSince,
+		},
+	}
+}
+
+// Engine evaluates the rules against every reading on the event bus and
+// hands what they fire to a notifier.
+type Engine struct {
+	rules    []Rule
+	notifier notify.Notifier
+}
+
+// NewEngine creates an engine for rules. Fired events are always logged and
+// also sent to notifier when it is not nil.
+func NewEngine(rules []Rule, notifier notify.Notifier) *Engine {
+	return &Engine{rules: rules, notifier: notifier}
+}
+
+// Run evaluates the readings on sub until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context, sub *events.Subscription) {
+	events.Consume(ctx, sub, func(event events.Event) {
+		if reading, ok := event.(events.ReadingEvent); ok {
+			e.evaluate(ctx, reading.Data)
+		}
+	})
+}
+
+// evaluate delivers notifications in the background so a slow receiver
+// does not hold up the next reading.
+func (e *Engine) evaluate(ctx context.Context, data *inverter.InverterData) {
+	for _, rule := range e.rules {
+		event := rule.Evaluate(data)
+		if event == nil {
+			continue
+		}
+
+		slog.Info("Alert", "type", event.Type, "message", event.Message)
+		if e.notifier == nil {
+			continue
+		}
+		go func(event notify.Event) {
+			if err := e.notifier.Notify(context.WithoutCancel(ctx), event); err != nil {
+				slog.Error("Error sending alert", "type", event.Type, "err", err)
+			}
+		}(*event)
+	}
+}
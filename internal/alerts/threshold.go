@@ -0,0 +1,140 @@
+package alerts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sungrow-monitor/internal/inverter"
+	"sungrow-monitor/internal/notify"
+	"sungrow-monitor/internal/sun"
+)
+
+// metrics are the reading values a Threshold can watch, named like the MQTT
+// value topics.
+var metrics = map[string]func(*inverter.InverterData) float64{
+	"power":          func(d *inverter.InverterData) float64 { return float64(d.TotalActivePower) },
+	"dc_power":       func(d *inverter.InverterData) float64 { return float64(d.TotalDCPower) },
+	"energy_daily":   func(d *inverter.InverterData) float64 { return d.DailyEnergy },
+	"temperature":    func(d *inverter.InverterData) float64 { return d.Temperature },
+	"mppt1_voltage":  func(d *inverter.InverterData) float64 { return d.MPPT1Voltage },
+	"mppt2_voltage":  func(d *inverter.InverterData) float64 { return d.MPPT2Voltage },
+	"grid_voltage":   func(d *inverter.InverterData) float64 { return d.GridVoltage },
+	"grid_frequency": func(d *inverter.InverterData) float64 { return d.GridFrequency },
+	"grid_current":   func(d *inverter.InverterData) float64 { return d.GridCurrent },
+	"power_factor":   func(d *inverter.InverterData) float64 { return d.PowerFactor },
+}
+
+var operators = map[string]func(value, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// ThresholdConfig describes a rule comparing a metric with a threshold.
+type ThresholdConfig struct {
+	// Name identifies the rule in notifications; empty derives one from
+	// the comparison.
+	Name      string
+	Metric    string
+	Operator  string
+	Threshold float64
+	// For is how long the comparison must hold before the rule fires.
+	For time.Duration
+	// Site, when set, limits the rule to daylight, e.g. so zero power
+	// at night is not a fault.
+	Site *sun.Site
+}
+
+// Threshold fires once when a metric enters violation of its threshold and
+// has stayed there for For. It re-arms when the metric comes back.
+type Threshold struct {
+	name      string
+	metric    string
+	operator  string
+	threshold float64
+	hold      time.Duration
+	site      *sun.Site
+
+	value   func(*inverter.InverterData) float64
+	compare func(value, threshold float64) bool
+
+	violatedSince time.Time
+	fired         bool
+}
+
+// NewThreshold validates cfg and returns its rule.
+func NewThreshold(cfg ThresholdConfig) (*Threshold, error) {
+	value, ok := metrics[cfg.Metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q (valid: %s)", cfg.Metric, strings.Join(keys(metrics), ", "))
+	}
+	compare, ok := operators[cfg.Operator]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator %q (valid: %s)", cfg.Operator, strings.Join(keys(operators), " "))
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = fmt.Sprintf("%s %s %g", cfg.Metric, cfg.Operator, cfg.Threshold)
+	}
+	return &Threshold{
+		name:      name,
+		metric:    cfg.Metric,
+		operator:  cfg.Operator,
+		threshold: cfg.Threshold,
+		hold:      cfg.For,
+		site:      cfg.Site,
+		value:     value,
+		compare:   compare,
+	}, nil
+}
+
+func keys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Threshold) Evaluate(data *inverter.InverterData) *notify.Event {
+	value := r.value(data)
+	violated := r.compare(value, r.threshold)
+	if violated && r.site != nil && !r.site.IsDaylight(data.Timestamp) {
+		violated = false
+	}
+	if !violated {
+		r.violatedSince = time.Time{}
+		r.fired = false
+		return nil
+	}
+
+	if r.violatedSince.IsZero() {
+		r.violatedSince = data.Timestamp
+	}
+	sustained := data.Timestamp.Sub(r.violatedSince)
+	if r.fired || sustained < r.hold {
+		return nil
+	}
+	r.fired = true
+
+	return &notify.Event{
+		Type:      "threshold",
+		Message:   fmt.Sprintf("%s: %s is %g", r.name, r.metric, value),
+		Timestamp: data.Timestamp,
+		Data: map[string]interface{}{
+			"rule":      r.name,
+			"metric":    r.metric,
+			"operator":  r.operator,
+			"threshold": r.threshold,
+			"value":     value,
+			"since":     r.violatedSince,
+		},
+	}
+}
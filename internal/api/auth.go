@@ -0,0 +1,45 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authMiddleware requires token as a bearer token, or in the token query
+// parameter for clients that cannot set headers (WebSocket, links). An
+// empty token leaves the routes open.
+func authMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		given := c.Query("token")
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			given = bearer
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="sungrow-monitor"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireTokenMiddleware refuses destructive routes and inverter writes
+// outright when no token is configured, since authMiddleware then lets
+// every request through.
+func requireTokenMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This endpoint requires api.auth_token to be set"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compareWindow is how far from the same time yesterday a reading may be
+// and still stand in for it.
+const compareWindow = 15 * time.Minute
+
+// yesterdayComparison is today's energy so far next to yesterday's at the
+// same time of day. The yesterday fields are null when there is no reading
+// close enough to compare against.
+type yesterdayComparison struct {
+	Timestamp    time.Time  `json:"timestamp"`
+	TodayKWh     float64    `json:"today_kwh"`
+	YesterdayKWh *float64   `json:"yesterday_kwh"`
+	YesterdayAt  *time.Time `json:"yesterday_at"`
+	DeltaKWh     *float64   `json:"delta_kwh"`
+	DeltaPercent *float64   `json:"delta_percent"`
+}
+
+func (s *Server) compareYesterdayHandler(c *gin.Context) {
+	now := s.now()
+	resp := yesterdayComparison{Timestamp: now}
+
+	if data := s.collector.GetLatestData(); data != nil && data.IsOnline && sameDay(data.Timestamp.In(s.location), now) {
+		resp.TodayKWh = data.DailyEnergy
+	} else {
+		energy, err := s.requestDB(c).GetDailyEnergy(now)
+		if err == nil {
+			resp.TodayKWh = energy
+		}
+	}
+
+	// Stay inside yesterday: the daily energy counter resets at midnight
+	target := now.AddDate(0, 0, -1)
+	dayStart := time.Date(target.Year(), target.Month(), target.Day(), 0, 0, 0, 0, target.Location())
+	dayEnd := dayStart.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	from, to := target.Add(-compareWindow), target.Add(compareWindow)
+	if from.Before(dayStart) {
+		from = dayStart
+	}
+	if to.After(dayEnd) {
+		to = dayEnd
+	}
+
+	readings, err := s.requestDB(c).GetReadingsByRange(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var nearestGap time.Duration = -1
+	for i := range readings {
+		gap := readings[i].Timestamp.Sub(target)
+		if gap < 0 {
+			gap = -gap
+		}
+		if nearestGap >= 0 && gap >= nearestGap {
+			continue
+		}
+		nearestGap = gap
+
+		yesterday := readings[i].DailyEnergy
+		at := readings[i].Timestamp
+		delta := resp.TodayKWh - yesterday
+		resp.YesterdayKWh = &yesterday
+		resp.YesterdayAt = &at
+		resp.DeltaKWh = &delta
+		resp.DeltaPercent = nil
+		if yesterday > 0 {
+			percent := delta / yesterday * 100
+			resp.DeltaPercent = &percent
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// diagnosticsTimeout bounds the whole probe run; a probe that has not
+// answered by then is reported as timed out.
+const diagnosticsTimeout = 5 * time.Second
+
+type dependencyStatus struct {
+	Status      string                 `json:"status"`
+	LatencyMs   float64                `json:"latency_ms"`
+	LastSuccess *time.Time             `json:"last_success,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+}
+
+type probe struct {
+	name string
+	run  func() dependencyStatus
+}
+
+// diagnosticsHandler probes every external dependency concurrently and
+// reports each one's state, latency and last success.
+func (s *Server) diagnosticsHandler(c *gin.Context) {
+	probes := []probe{
+		{"modbus", s.probeModbus},
+		{"mqtt", s.probeMQTT},
+		{"database", s.probeDatabase},
+	}
+
+	type result struct {
+		name   string
+		status dependencyStatus
+	}
+	results := make(chan result, len(probes))
+	for _, p := range probes {
+		go func(p probe) {
+			results <- result{p.name, p.run()}
+		}(p)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), diagnosticsTimeout)
+	defer cancel()
+
+	checks := make(map[string]dependencyStatus, len(probes))
+	for len(checks) < len(probes) {
+		select {
+		case r := <-results:
+			checks[r.name] = r.status
+		case <-ctx.Done():
+			for _, p := range probes {
+				if _, ok := checks[p.name]; !ok {
+					checks[p.name] = dependencyStatus{Status: "timeout", Error: "probe did not finish in time"}
+				}
+			}
+		}
+	}
+
+	overall := "ok"
+	for _, check := range checks {
+		if check.Status != "ok" && check.Status != "disabled" {
+			overall = "degraded"
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    overall,
+		"checks":    checks,
+		"timestamp": time.Now(),
+	})
+}
+
+func (s *Server) probeModbus() dependencyStatus {
+	var status dependencyStatus
+	if last := s.collector.LastSuccess(); !last.IsZero() {
+		status.LastSuccess = &last
+	}
+
+	latency, err := s.collector.ProbeInverter()
+	status.LatencyMs = float64(latency.Microseconds()) / 1000
+	if err != nil {
+		status.Status = "error"
+		status.Error = err.Error()
+		return status
+	}
+	status.Status = "ok"
+	return status
+}
+
+func (s *Server) probeMQTT() dependencyStatus {
+	if s.publisher == nil || !s.publisher.IsEnabled() {
+		return dependencyStatus{Status: "disabled"}
+	}
+	if !s.publisher.IsConnected() {
+		return dependencyStatus{Status: "error", Error: "not connected to broker"}
+	}
+	return dependencyStatus{Status: "ok"}
+}
+
+func (s *Server) probeDatabase() dependencyStatus {
+	start := time.Now()
+	if err := s.db.Ping(); err != nil {
+		return dependencyStatus{Status: "error", Error: err.Error()}
+	}
+	count, err := s.db.CountReadings()
+	status := dependencyStatus{
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Status = "error"
+		status.Error = err.Error()
+		return status
+	}
+
+	status.Status = "ok"
+	status.Details = map[string]interface{}{"readings": count}
+	return status
+}
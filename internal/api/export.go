@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sungrow-monitor/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultExportRange is used when the request names no range at all.
+	defaultExportRange = 7 * 24 * time.Hour
+	// maxExportRange bounds a single export so it cannot walk the whole DB.
+	maxExportRange = 366 * 24 * time.Hour
+	// exportBatchSize is the number of rows fetched and flushed per chunk.
+	exportBatchSize = 1000
+)
+
+// errExportLimitReached stops the batch walk once the row limit is hit.
+var errExportLimitReached = errors.New("export limit reached")
+
+// parseExportRange resolves the from/to query parameters, defaulting to the
+// last seven days and rejecting ranges longer than maxExportRange.
+func parseExportRange(c *gin.Context) (time.Time, time.Time, error) {
+	to := time.Now()
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Invalid 'to' date format")
+		}
+		to = parsed
+	}
+
+	from := to.Add(-defaultExportRange)
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Invalid 'from' date format")
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("'from' must be before 'to'")
+	}
+	if to.Sub(from) > maxExportRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("Range must not exceed %d days", int(maxExportRange.Hours()/24))
+	}
+	return from, to, nil
+}
+
+// exportReadingsHandler streams readings as CSV in chunks, flushing after
+// each one so that proxies forward data instead of buffering until timeout.
+func (s *Server) exportReadingsHandler(c *gin.Context) {
+	from, to, err := parseExportRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// CSV is the only format; the parameter is accepted so links can be
+	// explicit about it
+	if format := c.DefaultQuery("format", "csv"); format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'format' (only 'csv' is supported)"})
+		return
+	}
+
+	limit := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit'"})
+			return
+		}
+	}
+
+	filename := fmt.Sprintf("sungrow-%s-%s.csv", from.Format("20060102"), to.Format("20060102"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(storage.CSVHeader)
+
+	written := 0
+	err = s.requestDB(c).ForEachReadingInRange(from, to, exportBatchSize, func(batch []storage.InverterReading) error {
+		for i := range batch {
+			if limit > 0 && written >= limit {
+				return errExportLimitReached
+			}
+			if err := w.Write(batch[i].CSVRecord()); err != nil {
+				return err
+			}
+			written++
+		}
+		w.Flush()
+		c.Writer.Flush()
+		return w.Error()
+	})
+	w.Flush()
+	if err != nil && !errors.Is(err, errExportLimitReached) {
+		// Headers are already sent, so the best we can do is stop the stream.
+		slog.Warn("CSV export aborted", "rows", written, "err", err)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipMinSize is the smallest body worth compressing; below about one TCP
+// segment the gzip framing and CPU buy nothing.
+const gzipMinSize = 1400
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// gzipMiddleware compresses responses for clients that accept gzip. The
+// first gzipMinSize bytes are held back to decide: smaller bodies, bodies
+// that are not text or JSON and bodies that already have a
+// Content-Encoding go out as they are. WebSocket upgrades are left alone.
+// A Flush commits to a choice early so streamed responses keep flowing.
+func gzipMiddleware(c *gin.Context) {
+	c.Writer.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(c.Request) || c.GetHeader("Upgrade") != "" {
+		c.Next()
+		return
+	}
+
+	w := &gzipWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+	w.finish()
+	// Middleware further out, e.g. the timeout, writes directly again
+	c.Writer = w.ResponseWriter
+}
+
+// acceptsGzip reports whether Accept-Encoding lists gzip without q=0.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+			if !ok {
+				return true
+			}
+			weight, err := strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+	}
+	return false
+}
+
+// compressible reports whether contentType is text that gzip shrinks.
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json") ||
+		mediaType == jsonlContentType
+}
+
+// gzipWriter buffers the start of the body until it knows whether to
+// compress, then writes through a pooled gzip.Writer or directly.
+type gzipWriter struct {
+	gin.ResponseWriter
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < gzipMinSize {
+			return len(p), nil
+		}
+		w.decide()
+		return len(p), w.writeBuffered()
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		w.decide()
+		w.writeBuffered()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide compresses from here on if the headers allow it.
+func (w *gzipWriter) decide() {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || !compressible(header.Get("Content-Type")) {
+		return
+	}
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+}
+
+func (w *gzipWriter) writeBuffered() error {
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// finish sends what is still buffered, uncompressed if the whole body
+// stayed under gzipMinSize, and closes the gzip stream.
+func (w *gzipWriter) finish() {
+	if !w.decided {
+		w.decided = true
+		w.writeBuffered()
+		return
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"sungrow-monitor/internal/events"
+)
+
+// metricsContentType is the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metricsWriter renders gauges in the Prometheus text format, writing the
+// HELP and TYPE header once per metric name.
+type metricsWriter struct {
+	b       strings.Builder
+	serial  string
+	written map[string]bool
+}
+
+func (w *metricsWriter) gauge(name, help string, value float64, labels ...string) {
+	if !w.written[name] {
+		fmt.Fprintf(&w.b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		w.written[name] = true
+	}
+
+	w.b.WriteString(name)
+	w.b.WriteString(`{serial="`)
+	w.b.WriteString(escapeLabelValue(w.serial))
+	w.b.WriteByte('"')
+	for i := 0; i+1 < len(labels); i += 2 {
+		fmt.Fprintf(&w.b, `,%s="%s"`, labels[i], escapeLabelValue(labels[i+1]))
+	}
+	w.b.WriteString("} ")
+	w.b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.b.WriteByte('\n')
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// metricsHandler exposes the latest reading for Prometheus. sungrow_online
+// and sungrow_asleep follow the collector's current state; the other
+// gauges keep the last values read, with sungrow_last_reading_timestamp_seconds
+// telling how old they are.
+func (s *Server) metricsHandler(c *gin.Context) {
+	data := s.collector.GetLatestData()
+	state := s.collector.State()
+
+	w := &metricsWriter{written: make(map[string]bool)}
+	if data != nil {
+		w.serial = strings.TrimSpace(data.SerialNumber)
+	}
+
+	w.gauge("sungrow_online", "Whether the inverter answered the last poll with data (1) or not (0).", boolGauge(state == events.StateOnline))
+	w.gauge("sungrow_asleep", "Whether the inverter is in standby (1) or not (0).", boolGauge(state == events.StateAsleep))
+	w.gauge("sungrow_collecting", "Whether the collector is running (1) or not (0).", boolGauge(s.collector.IsCollecting()))
+
+	if data != nil && data.IsOnline {
+		w.gauge("sungrow_last_reading_timestamp_seconds", "Unix time of the reading behind the other gauges.", float64(data.Timestamp.Unix()))
+		w.gauge("sungrow_power_watts", "Total active AC power.", float64(data.TotalActivePower))
+		w.gauge("sungrow_reactive_power_var", "Reactive power.", float64(data.ReactivePower))
+		w.gauge("sungrow_apparent_power_va", "Apparent power.", float64(data.ApparentPower))
+		w.gauge("sungrow_power_factor", "Power factor.", data.PowerFactor)
+		w.gauge("sungrow_dc_power_watts", "Total DC input power.", float64(data.TotalDCPower))
+		if data.EfficiencyPercent > 0 {
+			w.gauge("sungrow_efficiency_percent", "AC output power over DC input power.", data.EfficiencyPercent)
+		}
+		if data.UtilizationPercent > 0 {
+			w.gauge("sungrow_utilization_percent", "AC output power over nominal power.", data.UtilizationPercent)
+		}
+		w.gauge("sungrow_daily_energy_kwh", "Energy produced today.", data.DailyEnergy)
+		w.gauge("sungrow_total_energy_kwh", "Energy counter reported by the inverter.", data.TotalEnergy)
+		if data.LifetimeEnergy > 0 {
+			w.gauge("sungrow_lifetime_energy_kwh", "Energy produced since monitoring began, across counter resets.", data.LifetimeEnergy)
+		}
+		w.gauge("sungrow_temperature_celsius", "Internal inverter temperature.", data.Temperature)
+		w.gauge("sungrow_grid_voltage_volts", "Grid phase-to-neutral voltage.", data.GridVoltage)
+		w.gauge("sungrow_grid_current_amperes", "Grid current.", data.GridCurrent)
+		w.gauge("sungrow_grid_frequency_hertz", "Grid frequency.", data.GridFrequency)
+		if data.GridPhases == 3 {
+			// Samples of one metric must stay together
+			voltages := map[string]float64{"a": data.PhaseAVoltage, "b": data.PhaseBVoltage, "c": data.PhaseCVoltage}
+			currents := map[string]float64{"a": data.PhaseACurrent, "b": data.PhaseBCurrent, "c": data.PhaseCCurrent}
+			for _, phase := range []string{"a", "b", "c"} {
+				w.gauge("sungrow_phase_voltage_volts", "Grid voltage per phase.", voltages[phase], "phase", phase)
+			}
+			for _, phase := range []string{"a", "b", "c"} {
+				w.gauge("sungrow_phase_current_amperes", "Grid current per phase.", currents[phase], "phase", phase)
+			}
+		}
+		w.gauge("sungrow_mppt_voltage_volts", "MPPT input voltage.", data.MPPT1Voltage, "mppt", "1")
+		w.gauge("sungrow_mppt_voltage_volts", "MPPT input voltage.", data.MPPT2Voltage, "mppt", "2")
+		w.gauge("sungrow_mppt_current_amperes", "MPPT input current.", data.MPPT1Current, "mppt", "1")
+		w.gauge("sungrow_mppt_current_amperes", "MPPT input current.", data.MPPT2Current, "mppt", "2")
+		w.gauge("sungrow_mppt_power_watts", "MPPT input power.", float64(data.MPPT1Power), "mppt", "1")
+		w.gauge("sungrow_mppt_power_watts", "MPPT input power.", float64(data.MPPT2Power), "mppt", "2")
+		w.gauge("sungrow_running_state", "Raw running state register.", float64(data.RunningState))
+		w.gauge("sungrow_fault_code", "Raw fault code register; 0 when there is no fault.", float64(data.FaultCode))
+	}
+
+	c.Data(http.StatusOK, metricsContentType, []byte(w.b.String()))
+}
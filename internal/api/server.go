@@ -2,16 +2,26 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"sungrow-monitor/config"
 	"sungrow-monitor/internal/collector"
+	"sungrow-monitor/internal/forecast"
+	"sungrow-monitor/internal/inverter"
+	"sungrow-monitor/internal/mqtt"
 	"sungrow-monitor/internal/storage"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type Server struct {
@@ -19,15 +29,78 @@ type Server struct {
 	server    *http.Server
 	collector *collector.Collector
 	db        *storage.Database
+	forecast  *forecast.Forecaster
+	publisher *mqtt.Publisher
 	port      int
 	webPath   string
+	model     string
+
+	producingThreshold uint32
+	minSamples         int64
+	forecastDays       int
+	forecastBucket     time.Duration
+	backfillDelay      time.Duration
+	staleAfter         time.Duration
+	staticMaxAge       time.Duration
+	requestTimeout     time.Duration
+	backfilling        atomic.Bool
+
+	authToken           string
+	tlsCert             string
+	tlsKey              string
+	maxWebSocketClients int
+	location            *time.Location
+	config              *config.Config
+	allowWrites         bool
+	wsClients           atomic.Int64
+	// shutdown is closed by Stop to end live connections, which
+	// http.Server.Shutdown does not track.
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
 type ServerConfig struct {
 	Port      int
 	Collector *collector.Collector
 	Database  *storage.Database
+	Forecast  *forecast.Forecaster
+	Publisher *mqtt.Publisher
 	WebPath   string
+	Model     string
+
+	ProducingThreshold uint32
+	BackfillDelay      time.Duration
+	StaleAfter         time.Duration
+	StaticMaxAge       time.Duration
+
+	// MinSamples is the fewest readings a time-of-day bucket needs before
+	// /api/v1/power/expected trusts its average; zero means 1.
+	MinSamples int64
+	// ForecastDays and ForecastBucket are the /api/v1/power/expected
+	// defaults when the query leaves them out; zero means 30 days and 15m.
+	ForecastDays   int
+	ForecastBucket time.Duration
+
+	// RequestTimeout bounds every API request except the streaming ones;
+	// zero disables it.
+	RequestTimeout time.Duration
+	// MaxWebSocketClients caps concurrent /api/v1/ws connections; zero
+	// means defaultMaxWebSocketClients.
+	MaxWebSocketClients int
+	// AuthToken, when set, is required on /api/v1 and /metrics.
+	AuthToken string
+	// TLSCert and TLSKey are PEM files; when both are set the server
+	// speaks HTTPS.
+	TLSCert string
+	TLSKey  string
+	// Location decides where the days of date parameters start; nil
+	// means time.Local.
+	Location *time.Location
+	// Config is the loaded configuration, shown redacted on /api/v1/config.
+	Config *config.Config
+	// AllowWrites enables the /api/v1/control endpoints, which change
+	// inverter settings.
+	AllowWrites bool
 }
 
 func NewServer(cfg ServerConfig) *Server {
@@ -42,12 +115,74 @@ func NewServer(cfg ServerConfig) *Server {
 		webPath = "./web"
 	}
 
+	model := cfg.Model
+	if model == "" {
+		model = inverter.DefaultModel
+	}
+
+	staticMaxAge := cfg.StaticMaxAge
+	if staticMaxAge == 0 {
+		staticMaxAge = time.Hour
+	}
+
+	maxWebSocketClients := cfg.MaxWebSocketClients
+	if maxWebSocketClients == 0 {
+		maxWebSocketClients = defaultMaxWebSocketClients
+	}
+
+	minSamples := cfg.MinSamples
+	if minSamples <= 0 {
+		minSamples = 1
+	}
+
+	forecastDays := cfg.ForecastDays
+	if forecastDays <= 0 {
+		forecastDays = 30
+	}
+
+	forecastBucket := cfg.ForecastBucket
+	if forecastBucket <= 0 {
+		forecastBucket = 15 * time.Minute
+	}
+
+	location := cfg.Location
+	if location == nil {
+		location = time.Local
+	}
+
 	s := &Server{
 		router:    router,
 		collector: cfg.Collector,
 		db:        cfg.Database,
+		forecast:  cfg.Forecast,
+		publisher: cfg.Publisher,
 		port:      cfg.Port,
 		webPath:   webPath,
+		model:     model,
+
+		producingThreshold: cfg.ProducingThreshold,
+		minSamples:         minSamples,
+		forecastDays:       forecastDays,
+		forecastBucket:     forecastBucket,
+		backfillDelay:      cfg.BackfillDelay,
+		staleAfter:         cfg.StaleAfter,
+		staticMaxAge:       staticMaxAge,
+		requestTimeout:     cfg.RequestTimeout,
+
+		authToken:           cfg.AuthToken,
+		tlsCert:             cfg.TLSCert,
+		tlsKey:              cfg.TLSKey,
+		maxWebSocketClients: maxWebSocketClients,
+		location:            location,
+		config:              cfg.Config,
+		allowWrites:         cfg.AllowWrites,
+		shutdown:            make(chan struct{}),
+	}
+
+	// Created up front so that Stop can run while Start is still starting
+	s.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.port),
+		Handler: s.router,
 	}
 
 	s.setupRoutes()
@@ -55,78 +190,180 @@ func NewServer(cfg ServerConfig) *Server {
 }
 
 func (s *Server) setupRoutes() {
-	// Load HTML templates
-	tmpl := template.Must(template.ParseGlob(s.webPath + "/templates/*.html"))
-	s.router.SetHTMLTemplate(tmpl)
-
-	// Serve static files
-	s.router.Static("/static", s.webPath+"/static")
-
-	// Dashboard routes
-	s.router.GET("/", s.dashboardHandler)
-	s.router.GET("/dashboard", s.dashboardHandler)
-	s.router.GET("/history", s.historyHandler)
+	// Load HTML templates; without them the API still serves headless
+	tmpl, err := template.ParseGlob(s.webPath + "/templates/*.html")
+	if err != nil {
+		slog.Warn("Web templates not loaded, dashboard disabled", "path", s.webPath, "err", err)
+	} else {
+		s.router.SetHTMLTemplate(tmpl)
+
+		// Serve static files
+		static := s.router.Group("/static", staticCacheMiddleware(s.webPath+"/static", s.staticMaxAge))
+		static.Static("/", s.webPath+"/static")
+
+		// Dashboard routes
+		pages := s.router.Group("/", noCacheMiddleware)
+		pages.GET("/", s.dashboardHandler)
+		pages.GET("/dashboard", s.dashboardHandler)
+		pages.GET("/history", s.historyHandler)
+	}
 
 	// Health check
 	s.router.GET("/health", s.healthHandler)
 
-	// API routes
-	api := s.router.Group("/api/v1")
+	// Everything below serves inverter data and needs the token, if any
+	auth := authMiddleware(s.authToken)
+
+	// Prometheus scrape endpoint
+	s.router.GET("/metrics", auth, s.metricsHandler)
+
+	// API routes, compressed for clients that accept it; the streaming
+	// ones are exempt from the request timeout
+	stream := s.router.Group("/api/v1", auth, gzipMiddleware)
+	{
+		stream.GET("/readings", s.readingsHandler)
+		stream.GET("/readings/export", s.exportReadingsHandler)
+		stream.GET("/ws", s.websocketHandler)
+	}
+
+	api := s.router.Group("/api/v1", auth, timeoutMiddleware(s.requestTimeout), gzipMiddleware)
 	{
 		api.GET("/status", s.statusHandler)
-		api.GET("/readings", s.readingsHandler)
+		api.GET("/diagnostics", s.diagnosticsHandler)
+		api.GET("/capabilities", s.capabilitiesHandler)
 		api.GET("/readings/latest", s.latestReadingHandler)
+		api.GET("/readings/recent", s.recentReadingsHandler)
+		api.GET("/readings/nearest", s.nearestReadingHandler)
+		api.GET("/readings/downsample", s.downsampledReadingsHandler)
 		api.GET("/energy/daily", s.dailyEnergyHandler)
+		api.GET("/energy/hourly", s.hourlyEnergyHandler)
+		api.GET("/energy/monthly", s.monthlyEnergyHandler)
+		api.GET("/energy/yearly", s.yearlyEnergyHandler)
 		api.GET("/energy/total", s.totalEnergyHandler)
+		api.GET("/energy/compare", s.compareYesterdayHandler)
 		api.GET("/stats/daily", s.dailyStatsHandler)
+		api.GET("/stats/range", s.rangeStatsHandler)
+		api.GET("/faults", s.faultsHandler)
+		api.GET("/forecast/today", s.forecastTodayHandler)
+		api.GET("/power/expected", s.expectedPowerHandler)
+		api.POST("/mqtt/backfill", s.mqttBackfillHandler)
+		api.POST("/maintenance/cleanup", requireTokenMiddleware(s.authToken), s.cleanupHandler)
+		api.POST("/maintenance/vacuum", requireTokenMiddleware(s.authToken), s.vacuumHandler)
+		api.POST("/collector/interval", s.collectorIntervalHandler)
+		api.POST("/collect", s.collectHandler)
+		api.POST("/control/power-limit", requireTokenMiddleware(s.authToken), s.powerLimitHandler)
+		api.GET("/config", s.configHandler)
+		api.GET("/settings", s.getSettingsHandler)
+		api.PATCH("/settings", s.patchSettingsHandler)
 	}
 }
 
 func (s *Server) dashboardHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "dashboard.html", gin.H{
 		"title": "Sungrow Monitor",
+		"model": s.model,
 	})
 }
 
 func (s *Server) historyHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "history.html", gin.H{
 		"title": "Sungrow Monitor - Historico",
+		"model": s.model,
 	})
 }
 
+// now returns the current time in the configured location.
+func (s *Server) now() time.Time {
+	return time.Now().In(s.location)
+}
+
+// Start serves until Stop is called, after which it returns nil.
 func (s *Server) Start() error {
-	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: s.router,
+	var err error
+	if s.tlsCert != "" && s.tlsKey != "" {
+		slog.Info("API server starting", "port", s.port, "tls", true)
+		err = s.server.ListenAndServeTLS(s.tlsCert, s.tlsKey)
+	} else {
+		slog.Info("API server starting", "port", s.port)
+		err = s.server.ListenAndServe()
 	}
-
-	log.Printf("API server starting on port %d", s.port)
-	return s.server.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
+// Stop stops accepting connections and waits for in-flight requests until
+// ctx is done.
 func (s *Server) Stop(ctx context.Context) error {
-	if s.server != nil {
-		return s.server.Shutdown(ctx)
-	}
-	return nil
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+	return s.server.Shutdown(ctx)
 }
 
 func (s *Server) healthHandler(c *gin.Context) {
 	status := "healthy"
 	inverterOnline := false
+	inverterAsleep := false
 
 	if data := s.collector.GetLatestData(); data != nil {
 		inverterOnline = data.IsOnline
+		inverterAsleep = data.IsAsleep
+	}
+
+	// Null until the first successful poll; an uptime monitor can alert on
+	// a growing age while the process itself stays up
+	var lastReadingAt *time.Time
+	var secondsSinceLastReading *float64
+	if last := s.collector.LastSuccess(); !last.IsZero() {
+		age := time.Since(last).Seconds()
+		lastReadingAt, secondsSinceLastReading = &last, &age
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status":          status,
-		"inverter_online": inverterOnline,
-		"collecting":      s.collector.IsCollecting(),
-		"timestamp":       time.Now(),
+		"status":                     status,
+		"inverter_online":            inverterOnline,
+		"inverter_asleep":            inverterAsleep,
+		"collecting":                 s.collector.IsCollecting(),
+		"mqtt_connected":             s.publisher != nil && s.publisher.IsConnected(),
+		"last_reading_at":            lastReadingAt,
+		"seconds_since_last_reading": secondsSinceLastReading,
+		"timestamp":                  time.Now(),
 	})
 }
 
+// capabilitiesResponse describes what data the API can be expected to
+// return for the connected inverter.
+type capabilitiesResponse struct {
+	inverter.Capabilities
+	ConfiguredModel string   `json:"configured_model"`
+	Detected        bool     `json:"detected"`
+	Fields          []string `json:"fields"`
+}
+
+func (s *Server) capabilitiesHandler(c *gin.Context) {
+	resp := capabilitiesResponse{
+		Capabilities:    inverter.DefaultCapabilities(),
+		ConfiguredModel: s.model,
+		Fields:          s.collector.Fields(),
+	}
+	resp.Model = s.model
+
+	// Until the first reading the configured model is all that is known
+	if data := s.collector.GetLatestData(); data != nil && data.IsOnline {
+		resp.Capabilities = inverter.DetectCapabilities(data)
+		resp.Detected = true
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// statusResponse is the latest data plus how fresh it is.
+type statusResponse struct {
+	*inverter.InverterData
+	AgeSeconds float64 `json:"age_seconds"`
+	Stale      bool    `json:"stale"`
+}
+
 func (s *Server) statusHandler(c *gin.Context) {
 	data := s.collector.GetLatestData()
 	if data == nil {
@@ -135,18 +372,57 @@ func (s *Server) statusHandler(c *gin.Context) {
 		})
 		return
 	}
-	c.JSON(http.StatusOK, data)
+
+	c.JSON(http.StatusOK, s.newStatus(data))
+}
+
+func (s *Server) newStatus(data *inverter.InverterData) statusResponse {
+	age := time.Since(data.Timestamp)
+	return statusResponse{
+		InverterData: data,
+		AgeSeconds:   age.Seconds(),
+		Stale:        s.staleAfter > 0 && age > s.staleAfter,
+	}
+}
+
+// defaultReadingsLimit and maxReadingsLimit bound the number of readings
+// returned when no range is given.
+const (
+	defaultReadingsLimit = 100
+	maxReadingsLimit     = 1000
+)
+
+// parseCount reads a positive integer query parameter, defaulting to def and
+// capped at maxReadingsLimit.
+func parseCount(c *gin.Context, key string, def int) (int, error) {
+	str := c.Query(key)
+	if str == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(str)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("Invalid '%s' (must be a positive integer)", key)
+	}
+	if n > maxReadingsLimit {
+		n = maxReadingsLimit
+	}
+	return n, nil
 }
 
 func (s *Server) readingsHandler(c *gin.Context) {
 	fromStr := c.Query("from")
 	toStr := c.Query("to")
-	limitStr := c.DefaultQuery("limit", "100")
 
-	var limit int
-	fmt.Sscanf(limitStr, "%d", &limit)
-	if limit <= 0 || limit > 1000 {
-		limit = 100
+	limit, err := parseCount(c, "limit", defaultReadingsLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "jsonl" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'format' (use 'json' or 'jsonl')"})
+		return
 	}
 
 	if fromStr != "" && toStr != "" {
@@ -161,16 +437,42 @@ func (s *Server) readingsHandler(c *gin.Context) {
 			return
 		}
 
-		readings, err := s.db.GetReadingsByRange(from, to)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+		if format == "jsonl" {
+			s.streamReadingsJSONL(c, from, to)
+		} else {
+			s.streamReadingsJSON(c, from, to)
+		}
+		return
+	}
+
+	readings, err := s.requestDB(c).GetReadingsWithLimit(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if format == "jsonl" {
+		c.Header("Content-Type", jsonlContentType)
+		c.Status(http.StatusOK)
+		enc := json.NewEncoder(c.Writer)
+		for i := range readings {
+			if err := enc.Encode(&readings[i]); err != nil {
+				return
+			}
 		}
-		c.JSON(http.StatusOK, readings)
+		return
+	}
+	c.JSON(http.StatusOK, readings)
+}
+
+// recentReadingsHandler returns the n most recent readings, newest first.
+func (s *Server) recentReadingsHandler(c *gin.Context) {
+	n, err := parseCount(c, "n", defaultReadingsLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	readings, err := s.db.GetReadingsWithLimit(limit)
+	readings, err := s.requestDB(c).GetReadingsWithLimit(n)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -179,7 +481,30 @@ func (s *Server) readingsHandler(c *gin.Context) {
 }
 
 func (s *Server) latestReadingHandler(c *gin.Context) {
-	reading, err := s.db.GetLatestReading()
+	reading, err := s.requestDB(c).GetLatestReading()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no readings yet"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, reading)
+}
+
+func (s *Server) nearestReadingHandler(c *gin.Context) {
+	t, err := time.Parse(time.RFC3339, c.Query("t"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 't' date format"})
+		return
+	}
+
+	reading, err := s.requestDB(c).GetNearestReading(t)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No readings available"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -188,14 +513,18 @@ func (s *Server) latestReadingHandler(c *gin.Context) {
 }
 
 func (s *Server) dailyEnergyHandler(c *gin.Context) {
-	dateStr := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
-	date, err := time.Parse("2006-01-02", dateStr)
+	dateStr := c.DefaultQuery("date", s.now().Format("2006-01-02"))
+	date, err := time.ParseInLocation("2006-01-02", dateStr, s.location)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
 		return
 	}
 
-	energy, err := s.db.GetDailyEnergy(date)
+	energy, err := s.requestDB(c).GetDailyEnergy(date)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no readings for this day"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -207,27 +536,97 @@ func (s *Server) dailyEnergyHandler(c *gin.Context) {
 	})
 }
 
+func (s *Server) hourlyEnergyHandler(c *gin.Context) {
+	dateStr := c.DefaultQuery("date", s.now().Format("2006-01-02"))
+	// Hours are local, like the inverter's daily counter
+	date, err := time.ParseInLocation("2006-01-02", dateStr, s.location)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+		return
+	}
+
+	hours, err := s.requestDB(c).GetHourlyEnergy(date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":  dateStr,
+		"hours": hours,
+	})
+}
+
+func (s *Server) monthlyEnergyHandler(c *gin.Context) {
+	now := s.now()
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(now.Year())))
+	if err != nil || year < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'year' value"})
+		return
+	}
+	month, err := strconv.Atoi(c.DefaultQuery("month", strconv.Itoa(int(now.Month()))))
+	if err != nil || month < 1 || month > 12 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'month' value"})
+		return
+	}
+
+	energy, err := s.requestDB(c).GetMonthlyEnergy(year, month, s.location)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, energy)
+}
+
+func (s *Server) yearlyEnergyHandler(c *gin.Context) {
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(s.now().Year())))
+	if err != nil || year < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'year' value"})
+		return
+	}
+
+	energy, err := s.requestDB(c).GetYearlyEnergy(year, s.location)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, energy)
+}
+
 func (s *Server) totalEnergyHandler(c *gin.Context) {
-	energy, err := s.db.GetTotalEnergy()
+	energy, err := s.requestDB(c).GetTotalEnergy()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no readings yet"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	lifetime, err := s.requestDB(c).GetLifetimeEnergy()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"total_energy_kwh": energy,
+		"total_energy_kwh":    energy,
+		"lifetime_energy_kwh": lifetime,
 	})
 }
 
 func (s *Server) dailyStatsHandler(c *gin.Context) {
-	dateStr := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
-	date, err := time.Parse("2006-01-02", dateStr)
+	dateStr := c.DefaultQuery("date", s.now().Format("2006-01-02"))
+	date, err := time.ParseInLocation("2006-01-02", dateStr, s.location)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
 		return
 	}
 
-	stats, err := s.db.GetDailyStats(date)
+	stats, err := s.requestDB(c).GetDailyStats(date, s.producingThreshold)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -235,3 +634,379 @@ func (s *Server) dailyStatsHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, stats)
 }
+
+func (s *Server) rangeStatsHandler(c *gin.Context) {
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' date format"})
+		return
+	}
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date format"})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'from' must be before 'to'"})
+		return
+	}
+
+	stats, err := s.requestDB(c).GetStatsByRange(from, to, s.producingThreshold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (s *Server) faultsHandler(c *gin.Context) {
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' date format"})
+		return
+	}
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date format"})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'from' must be before 'to'"})
+		return
+	}
+
+	faults, err := s.requestDB(c).GetFaultEvents(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, faults)
+}
+
+const (
+	defaultDownsamplePoints = 200
+	maxDownsamplePoints     = 2000
+)
+
+func (s *Server) downsampledReadingsHandler(c *gin.Context) {
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' date format"})
+		return
+	}
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date format"})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'from' must be before 'to'"})
+		return
+	}
+
+	points := defaultDownsamplePoints
+	if pointsStr := c.Query("points"); pointsStr != "" {
+		points, err = strconv.Atoi(pointsStr)
+		if err != nil || points <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'points' value"})
+			return
+		}
+	}
+	if points > maxDownsamplePoints {
+		points = maxDownsamplePoints
+	}
+
+	buckets, err := s.requestDB(c).GetDownsampledReadings(from, to, points)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, buckets)
+}
+
+func (s *Server) getSettingsHandler(c *gin.Context) {
+	settings, err := s.requestDB(c).GetAllSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// patchSettingsHandler merges a JSON object into the settings store. A null
+// value removes the key. The body is applied whole or not at all.
+func (s *Server) patchSettingsHandler(c *gin.Context) {
+	var changes map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Body must be a JSON object"})
+		return
+	}
+
+	for key := range changes {
+		if key == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Setting keys must not be empty"})
+			return
+		}
+	}
+	if err := s.requestDB(c).UpdateSettings(changes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.getSettingsHandler(c)
+}
+
+// configHandler shows the configuration the service is running with, with
+// secrets redacted, for troubleshooting.
+func (s *Server) configHandler(c *gin.Context) {
+	if s.config == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Configuration is not available"})
+		return
+	}
+	c.JSON(http.StatusOK, s.config.Redacted())
+}
+
+func (s *Server) forecastTodayHandler(c *gin.Context) {
+	if s.forecast == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Forecast is not configured"})
+		return
+	}
+
+	data := s.collector.GetLatestData()
+	if data == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "No data available yet",
+		})
+		return
+	}
+
+	estimate, err := s.forecast.Today(data.Timestamp.In(s.location), data.DailyEnergy, float64(data.TotalActivePower))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, estimate)
+}
+
+// maxExpectedPowerDays bounds how far back /api/v1/power/expected averages.
+const maxExpectedPowerDays = 365
+
+// expectedPowerHandler compares the current power with the historical
+// average for the same time-of-day bucket over the previous days.
+func (s *Server) expectedPowerHandler(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(s.forecastDays)))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'days' parameter"})
+		return
+	}
+	if days > maxExpectedPowerDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("'days' must be at most %d", maxExpectedPowerDays)})
+		return
+	}
+	bucket, err := time.ParseDuration(c.DefaultQuery("bucket", s.forecastBucket.String()))
+	if err != nil || bucket <= 0 || bucket > 24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'bucket' parameter"})
+		return
+	}
+
+	data := s.collector.GetLatestData()
+	if data == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "No data available yet",
+		})
+		return
+	}
+
+	at := data.Timestamp.In(s.location)
+	actual := float64(data.TotalActivePower)
+	avg, samples, err := s.requestDB(c).GetAveragePowerForTimeOfDay(at, days, bucket, s.minSamples)
+	if err != nil && !errors.Is(err, storage.ErrInsufficientData) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var expected, ratio *float64
+	if err == nil {
+		expected = &avg
+		if avg > 0 {
+			r := actual / avg * 100
+			ratio = &r
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp":        at,
+		"actual_power_w":   actual,
+		"expected_power_w": expected,
+		"ratio_percent":    ratio,
+		"samples":          samples,
+		"days":             days,
+		"bucket":           bucket.String(),
+	})
+}
+
+// maxBackfillRange bounds a single /api/v1/mqtt/backfill request.
+const maxBackfillRange = 7 * 24 * time.Hour
+
+// mqttBackfillHandler republishes a range of stored readings to MQTT in the
+// background so subscribers can recover from broker downtime.
+func (s *Server) mqttBackfillHandler(c *gin.Context) {
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' date format"})
+		return
+	}
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date format"})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'from' must be before 'to'"})
+		return
+	}
+	// The whole range is held in memory until it has been republished
+	if to.Sub(from) > maxBackfillRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Range must not exceed %d days", int(maxBackfillRange.Hours()/24))})
+		return
+	}
+
+	if s.publisher == nil || !s.publisher.IsConnected() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "MQTT is not connected"})
+		return
+	}
+
+	delay := s.backfillDelay
+	if delayStr := c.Query("delay"); delayStr != "" {
+		delay, err = time.ParseDuration(delayStr)
+		if err != nil || delay < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'delay'"})
+			return
+		}
+	}
+
+	readings, err := s.requestDB(c).GetReadingsByRange(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !s.backfilling.CompareAndSwap(false, true) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A backfill is already running"})
+		return
+	}
+
+	history := make([]*inverter.InverterData, 0, len(readings))
+	for i := len(readings) - 1; i >= 0; i-- {
+		history = append(history, readings[i].ToInverterData())
+	}
+
+	go func() {
+		defer s.backfilling.Store(false)
+		sent, err := s.publisher.Republish(context.Background(), history, delay)
+		if err != nil {
+			slog.Warn("MQTT backfill stopped", "readings", sent, "err", err)
+			return
+		}
+		slog.Info("MQTT backfill finished", "readings", sent)
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"queued":   len(history),
+		"delay_ms": delay.Milliseconds(),
+	})
+}
+
+func (s *Server) cleanupHandler(c *gin.Context) {
+	olderThan, err := time.ParseDuration(c.Query("older_than"))
+	if err != nil || olderThan <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'older_than' must be a positive duration, e.g. 720h"})
+		return
+	}
+
+	deleted, err := s.requestDB(c).CleanOldReadings(olderThan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Maintenance cleanup finished", "deleted", deleted, "older_than", olderThan)
+
+	c.JSON(http.StatusOK, gin.H{
+		"deleted":    deleted,
+		"older_than": olderThan.String(),
+	})
+}
+
+// collectorIntervalHandler changes the polling interval without a restart.
+// The change is not written back to the config file.
+func (s *Server) collectorIntervalHandler(c *gin.Context) {
+	interval, err := time.ParseDuration(c.Query("interval"))
+	if err != nil || interval <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'interval' must be a positive duration, e.g. 30s"})
+		return
+	}
+
+	previous := s.collector.Interval()
+	if err := s.collector.UpdateInterval(interval); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"interval":          interval.String(),
+		"previous_interval": previous.String(),
+	})
+}
+
+// collectHandler reads the inverter right away over the collector's
+// connection. The reading is stored and published like a scheduled one.
+func (s *Server) collectHandler(c *gin.Context) {
+	data, err := s.collector.CollectOnce()
+	if err != nil && !errors.Is(err, inverter.ErrAsleep) {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+// powerLimitHandler caps the inverter's output at a percentage of its
+// nominal power. Writes are refused unless inverter.allow_writes is set.
+func (s *Server) powerLimitHandler(c *gin.Context) {
+	if !s.allowWrites {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Writes to the inverter are disabled (inverter.allow_writes)"})
+		return
+	}
+
+	percent, err := strconv.ParseFloat(c.Query("percent"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'percent' must be a number between 0 and 100"})
+		return
+	}
+
+	if err := s.collector.SetPowerLimit(percent); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"percent": percent,
+	})
+}
+
+func (s *Server) vacuumHandler(c *gin.Context) {
+	start := time.Now()
+	if err := s.requestDB(c).Vacuum(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "ok",
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sungrow-monitor/internal/storage"
+)
+
+// newTestServer builds a server without web templates, database or
+// collector, for the routes that answer before reaching them.
+func newTestServer(t *testing.T, cfg ServerConfig) *Server {
+	t.Helper()
+	cfg.WebPath = t.TempDir()
+	return NewServer(cfg)
+}
+
+// newTestDatabase opens a database in a temporary directory.
+func newTestDatabase(t *testing.T) *storage.Database {
+	t.Helper()
+	db, err := storage.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func serve(s *Server, method, target, token string) *httptest.ResponseRecorder {
+	return serveBody(s, method, target, token, nil)
+}
+
+func serveBody(s *Server, method, target, token string, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPowerLimitNeedsToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		authToken  string
+		given      string
+		wantStatus int
+	}{
+		{"writes enabled without a token configured", "", "", http.StatusForbidden},
+		{"missing token", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "guess", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, ServerConfig{AllowWrites: true, AuthToken: tt.authToken})
+			rec := serve(s, http.MethodPost, "/api/v1/control/power-limit?percent=50", tt.given)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestPowerLimitWithTokenStillNeedsAllowWrites(t *testing.T) {
+	s := newTestServer(t, ServerConfig{AuthToken: "secret"})
+	rec := serve(s, http.MethodPost, "/api/v1/control/power-limit?percent=50", "secret")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+}
+
+func TestPatchSettingsRejectedBodyChangesNothing(t *testing.T) {
+	db := newTestDatabase(t)
+	if err := db.SetSetting("theme", "dark"); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+	s := newTestServer(t, ServerConfig{Database: db})
+
+	// Whatever order the keys are visited in, none may be stored
+	for i := 0; i < 20; i++ {
+		rec := serveBody(s, http.MethodPatch, "/api/v1/settings", "", strings.NewReader(`{"a":1,"theme":null,"b":2,"":3}`))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+		}
+	}
+
+	settings, err := db.GetAllSettings()
+	if err != nil {
+		t.Fatalf("GetAllSettings: %v", err)
+	}
+	if len(settings) != 1 || string(settings["theme"]) != `"dark"` {
+		t.Errorf("settings = %v, want only theme unchanged", settings)
+	}
+}
+
+func TestExpectedPowerRejectsTooManyDays(t *testing.T) {
+	s := newTestServer(t, ServerConfig{})
+
+	rec := serve(s, http.MethodGet, "/api/v1/power/expected?days=366", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestMQTTBackfillRejectsLongRanges(t *testing.T) {
+	s := newTestServer(t, ServerConfig{})
+
+	tests := map[string]string{
+		"too long": "from=2024-01-01T00:00:00Z&to=2024-01-09T00:00:00Z",
+		"reversed": "from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z",
+	}
+	for name, query := range tests {
+		rec := serve(s, http.MethodPost, "/api/v1/mqtt/backfill?"+query, "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", name, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	// A valid range gets as far as the broker check
+	rec := serve(s, http.MethodPost, "/api/v1/mqtt/backfill?from=2024-01-01T00:00:00Z&to=2024-01-08T00:00:00Z", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hashedAsset matches fingerprinted file names such as app.3f9a1c2b.js,
+// whose content never changes under the same name.
+var hashedAsset = regexp.MustCompile(`\.[0-9a-f]{8,}\.[a-z0-9]+$`)
+
+const hashedAssetMaxAge = 365 * 24 * time.Hour
+
+// staticCacheMiddleware sets Cache-Control and an ETag on static assets.
+// http.ServeContent answers If-None-Match with 304 when the ETag header is
+// already set on the response.
+func staticCacheMiddleware(root string, maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("filepath")
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(filepath.Clean("/"+name))))
+		if err != nil || info.IsDir() {
+			c.Next()
+			return
+		}
+
+		age := maxAge
+		cacheControl := "public, max-age=%d"
+		if hashedAsset.MatchString(name) {
+			age = hashedAssetMaxAge
+			cacheControl += ", immutable"
+		}
+		c.Header("Cache-Control", fmt.Sprintf(cacheControl, int(age.Seconds())))
+		c.Header("ETag", fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+		c.Next()
+	}
+}
+
+// noCacheMiddleware makes browsers revalidate the HTML pages on every load
+// so new asset references are picked up immediately.
+func noCacheMiddleware(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache")
+	c.Next()
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"sungrow-monitor/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamFlushEvery is how many rows are written between flushes.
+const streamFlushEvery = 500
+
+// streamReadingsJSON writes the readings in [from, to] as a JSON array while
+// they are scanned, using chunked transfer encoding. Once the first row is
+// out the status code can no longer change, so a later error is logged and
+// the array is left unterminated for the client to detect. The scan is
+// bound to the request context and stops when the client disconnects.
+func (s *Server) streamReadingsJSON(c *gin.Context, from, to time.Time) {
+	written := 0
+	err := s.requestDB(c).StreamReadingsByRange(from, to, func(reading *storage.InverterReading) error {
+		payload, err := json.Marshal(reading)
+		if err != nil {
+			return err
+		}
+
+		if written == 0 {
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			c.Status(http.StatusOK)
+			c.Writer.WriteString("[")
+		} else {
+			c.Writer.WriteString(",")
+		}
+		if _, err := c.Writer.Write(payload); err != nil {
+			return err
+		}
+
+		written++
+		if written%streamFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil && written == 0:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case err != nil:
+		slog.Warn("Readings stream truncated", "rows", written, "err", err)
+	case written == 0:
+		c.JSON(http.StatusOK, []storage.InverterReading{})
+	default:
+		c.Writer.WriteString("]")
+	}
+}
+
+// jsonlContentType is the media type of newline-delimited JSON.
+const jsonlContentType = "application/x-ndjson"
+
+// streamReadingsJSONL writes the readings in [from, to] as JSON Lines, one
+// compact object per line, while they are scanned. Errors are handled as
+// in streamReadingsJSON; a truncated stream simply ends early.
+func (s *Server) streamReadingsJSONL(c *gin.Context, from, to time.Time) {
+	enc := json.NewEncoder(c.Writer)
+	written := 0
+	err := s.requestDB(c).StreamReadingsByRange(from, to, func(reading *storage.InverterReading) error {
+		if written == 0 {
+			c.Header("Content-Type", jsonlContentType)
+			c.Status(http.StatusOK)
+		}
+		if err := enc.Encode(reading); err != nil {
+			return err
+		}
+
+		written++
+		if written%streamFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil && written == 0:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case err != nil:
+		slog.Warn("Readings stream truncated", "rows", written, "err", err)
+	case written == 0:
+		c.Data(http.StatusOK, jsonlContentType, nil)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"sungrow-monitor/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutMiddleware gives each request a deadline. Handlers run on the
+// request goroutine and pass the context to the database (see requestDB),
+// so a slow query is cancelled rather than abandoned. A request that runs
+// out of time answers 504: either the handler's own error response is
+// turned into one, or one is written if the handler wrote nothing.
+func timeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx}
+		c.Next()
+
+		if !c.Writer.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out"})
+		}
+	}
+}
+
+// timeoutWriter reports server errors written after the deadline as 504.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx context.Context
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if code >= http.StatusInternalServerError && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		code = http.StatusGatewayTimeout
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// requestDB returns the database bound to the request context.
+func (s *Server) requestDB(c *gin.Context) *storage.Database {
+	return s.db.WithContext(c.Request.Context())
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"sungrow-monitor/internal/events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// defaultMaxWebSocketClients caps concurrent live connections when the
+	// config leaves it unset.
+	defaultMaxWebSocketClients = 16
+
+	wsWriteTimeout = 10 * time.Second
+	// wsPongTimeout is how long a client may stay silent, pongs included,
+	// before it is considered gone; pings go out well within it.
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = wsPongTimeout * 9 / 10
+	// wsBuffer is how many readings a slow client may fall behind.
+	wsBuffer = 4
+)
+
+// The default origin check only admits pages served by this host.
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// websocketHandler pushes the status, as returned by /status, to the
+// client right away, after every poll that produced a reading and whenever
+// the inverter changes state.
+func (s *Server) websocketHandler(c *gin.Context) {
+	if s.wsClients.Add(1) > int64(s.maxWebSocketClients) {
+		s.wsClients.Add(-1)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many live connections"})
+		return
+	}
+	defer s.wsClients.Add(-1)
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already answered with an error
+		return
+	}
+	defer conn.Close()
+
+	bus := s.collector.Bus()
+	sub := bus.Subscribe("websocket "+c.ClientIP(), wsBuffer)
+	defer bus.Unsubscribe(sub)
+
+	// Control frames are only processed while reading, and a failed read is
+	// how a disconnect shows up
+	gone := make(chan struct{})
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(v interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(v)
+	}
+
+	if data := s.collector.GetLatestData(); data != nil {
+		if err := send(s.newStatus(data)); err != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case <-s.shutdown:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+			return
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			data := s.collector.GetLatestData()
+			if reading, ok := event.(events.ReadingEvent); ok {
+				data = reading.Data
+			}
+			if data == nil {
+				continue
+			}
+			if err := send(s.newStatus(data)); err != nil {
+				return
+			}
+		}
+	}
+}
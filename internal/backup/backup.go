@@ -0,0 +1,216 @@
+// Package backup periodically uploads the readings stored since the last
+// run to off-device storage.
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"sungrow-monitor/internal/storage"
+)
+
+// Export formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// lastExportedSetting records the timestamp of the newest reading uploaded.
+const lastExportedSetting = "backup.last_exported"
+
+// exportBatchSize is the number of readings fetched per query.
+const exportBatchSize = 1000
+
+// Object is a finished export ready to upload.
+type Object struct {
+	Name        string
+	ContentType string
+	Body        io.ReadSeeker
+	Size        int64
+	SHA256      string // hex encoded
+}
+
+// Target stores exported objects remotely.
+type Target interface {
+	Upload(ctx context.Context, obj Object) error
+}
+
+// Job exports the readings added since the previous run on every interval.
+type Job struct {
+	db       *storage.Database
+	target   Target
+	interval time.Duration
+	format   string
+	prefix   string
+}
+
+type JobConfig struct {
+	Database *storage.Database
+	Target   Target
+	Interval time.Duration
+	Format   string // FormatCSV or FormatNDJSON
+	Prefix   string // prepended to object names
+}
+
+func NewJob(cfg JobConfig) (*Job, error) {
+	format := cfg.Format
+	if format == "" {
+		format = FormatCSV
+	}
+	if format != FormatCSV && format != FormatNDJSON {
+		return nil, fmt.Errorf("unknown backup format %q", format)
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("backup interval must be positive")
+	}
+
+	return &Job{
+		db:       cfg.Database,
+		target:   cfg.Target,
+		interval: cfg.Interval,
+		format:   format,
+		prefix:   cfg.Prefix,
+	}, nil
+}
+
+// Start runs an export right away and then on every interval until ctx is
+// cancelled.
+func (j *Job) Start(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.RunOnce(ctx); err != nil {
+			slog.Error("Backup failed", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce uploads the readings newer than the last export. Nothing is
+// uploaded when there are none.
+func (j *Job) RunOnce(ctx context.Context) error {
+	var since time.Time
+	if _, err := j.db.GetSetting(lastExportedSetting, &since); err != nil {
+		return err
+	}
+	until := time.Now()
+
+	file, err := os.CreateTemp("", "sungrow-backup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	count, oldest, newest, err := j.write(io.MultiWriter(file, hash), since, until)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	obj := Object{
+		Name:   fmt.Sprintf("%ssungrow-%s-%s.%s", j.prefix, oldest.UTC().Format("20060102T150405Z"), newest.UTC().Format("20060102T150405Z"), j.format),
+		Body:   file,
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}
+	if j.format == FormatCSV {
+		obj.ContentType = "text/csv; charset=utf-8"
+	} else {
+		obj.ContentType = "application/x-ndjson"
+	}
+
+	if err := j.target.Upload(ctx, obj); err != nil {
+		return err
+	}
+	if err := j.db.SetSetting(lastExportedSetting, newest); err != nil {
+		return err
+	}
+
+	slog.Info("Backup uploaded", "readings", count, "object", obj.Name)
+	return nil
+}
+
+// write serializes the readings in (since, until] and returns how many were
+// written and the oldest and newest timestamps among them.
+func (j *Job) write(w io.Writer, since, until time.Time) (int, time.Time, time.Time, error) {
+	var (
+		count  int
+		oldest time.Time
+		newest time.Time
+		csvw   *csv.Writer
+		enc    *json.Encoder
+	)
+	if j.format == FormatCSV {
+		csvw = csv.NewWriter(w)
+		if err := csvw.Write(storage.CSVHeader); err != nil {
+			return 0, oldest, newest, err
+		}
+	} else {
+		enc = json.NewEncoder(w)
+	}
+
+	err := j.db.ForEachReadingInRange(since, until, exportBatchSize, func(batch []storage.InverterReading) error {
+		for i := range batch {
+			reading := &batch[i]
+			if !reading.Timestamp.After(since) {
+				continue
+			}
+
+			var err error
+			if csvw != nil {
+				err = csvw.Write(reading.CSVRecord())
+			} else {
+				err = enc.Encode(reading)
+			}
+			if err != nil {
+				return err
+			}
+
+			count++
+			if oldest.IsZero() || reading.Timestamp.Before(oldest) {
+				oldest = reading.Timestamp
+			}
+			if reading.Timestamp.After(newest) {
+				newest = reading.Timestamp
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, oldest, newest, fmt.Errorf("failed to export readings: %w", err)
+	}
+
+	if csvw != nil {
+		csvw.Flush()
+		if err := csvw.Error(); err != nil {
+			return 0, oldest, newest, err
+		}
+	}
+	return count, oldest, newest, nil
+}
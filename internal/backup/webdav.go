@@ -0,0 +1,49 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WebDAV uploads objects with a PUT below a collection URL.
+type WebDAV struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+func NewWebDAV(url, username, password string, timeout time.Duration) *WebDAV {
+	return &WebDAV{
+		url:      strings.TrimSuffix(url, "/"),
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (w *WebDAV) Upload(ctx context.Context, obj Object) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, w.url+"/"+escapeKey(obj.Name), obj.Body)
+	if err != nil {
+		return fmt.Errorf("failed to create WebDAV request: %w", err)
+	}
+	req.ContentLength = obj.Size
+	req.Header.Set("Content-Type", obj.ContentType)
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload to WebDAV: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("WebDAV upload returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
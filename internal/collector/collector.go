@@ -2,115 +2,354 @@ package collector
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
+	"sungrow-monitor/internal/events"
 	"sungrow-monitor/internal/inverter"
 	"sungrow-monitor/internal/modbus"
-	"sungrow-monitor/internal/mqtt"
-	"sungrow-monitor/internal/storage"
+	"sungrow-monitor/internal/sun"
 )
 
 type Collector struct {
-	client    *modbus.Client
-	sungrow   *inverter.Sungrow
-	db        *storage.Database
-	publisher *mqtt.Publisher
-	interval  time.Duration
-	enabled   bool
-
-	mu          sync.RWMutex
-	latestData  *inverter.InverterData
+	client   *modbus.Client
+	sungrow  *inverter.Sungrow
+	bus      *events.Bus
+	energy   LifetimeTracker
+	schedule Schedule
+	enabled  bool
+	align    bool
+	location *time.Location
+
+	// readMu serializes requests to the inverter between the polling loop,
+	// CollectOnce and SetPowerLimit
+	readMu sync.Mutex
+
+	mu           sync.RWMutex
+	latestData   *inverter.InverterData
 	isCollecting bool
+	lastSuccess  time.Time
+	state        events.State
+	failures     int
+	maxFailures  int
+
+	// intervalChanged wakes Start to re-arm its timer after UpdateInterval
+	intervalChanged chan struct{}
+}
+
+// LifetimeTracker folds the inverter's total energy counter into a total
+// that survives counter resets; see storage.Database.TrackLifetimeEnergy.
+type LifetimeTracker interface {
+	TrackLifetimeEnergy(total float64) (lifetime float64, reset bool, err error)
 }
 
 type CollectorConfig struct {
-	Client    *modbus.Client
-	Database  *storage.Database
-	Publisher *mqtt.Publisher
-	Interval  time.Duration
-	Enabled   bool
+	Client   *modbus.Client
+	Interval time.Duration
+	Enabled  bool
+	Model    string
+	Fields   []string
+
+	// Registers gives the register addresses of the model; the zero value
+	// means inverter.DefaultRegisterMap.
+	Registers inverter.RegisterMap
+
+	// AsleepInterval, OfflineBackoff and OfflineMaxBackoff complete the
+	// polling Schedule; zero falls back to Interval.
+	AsleepInterval    time.Duration
+	OfflineBackoff    time.Duration
+	OfflineMaxBackoff time.Duration
+
+	// Bus receives a ReadingEvent for every successful read and a
+	// StateChangeEvent when the inverter goes online, asleep or offline.
+	// Storage, MQTT and alerts subscribe to it; nil creates a private bus.
+	Bus *events.Bus
+	// Energy fills in InverterData.LifetimeEnergy before the reading is
+	// published; nil leaves it empty.
+	Energy LifetimeTracker
+
+	// AlignTimestamps snaps each reading's timestamp to the nearest
+	// multiple of Interval.
+	AlignTimestamps bool
+
+	// MaxConsecutiveFailures is how many reads in a row may fail on an
+	// open connection before it is dropped and reopened; zero means
+	// defaultMaxConsecutiveFailures.
+	MaxConsecutiveFailures int
+
+	// Daylight, when set, slows polling to NightInterval between sunset
+	// and sunrise there; zero NightInterval means defaultNightInterval.
+	Daylight      *sun.Site
+	NightInterval time.Duration
+
+	// Location decides when a new day starts for the daily energy of an
+	// offline reading; nil means time.Local.
+	Location *time.Location
 }
 
-func NewCollector(cfg CollectorConfig) *Collector {
-	return &Collector{
-		client:    cfg.Client,
-		sungrow:   inverter.NewSungrow(cfg.Client),
-		db:        cfg.Database,
-		publisher: cfg.Publisher,
-		interval:  cfg.Interval,
-		enabled:   cfg.Enabled,
+// defaultNightInterval still catches the inverter waking up in the morning.
+const defaultNightInterval = 15 * time.Minute
+
+// defaultMaxConsecutiveFailures rides out a couple of lost frames before
+// giving up on the connection.
+const defaultMaxConsecutiveFailures = 3
+
+func NewCollector(cfg CollectorConfig) (*Collector, error) {
+	sungrow, err := inverter.NewSungrow(cfg.Client, cfg.Model, cfg.Fields, cfg.Registers)
+	if err != nil {
+		return nil, err
+	}
+
+	bus := cfg.Bus
+	if bus == nil {
+		bus = events.NewBus()
+	}
+
+	maxFailures := cfg.MaxConsecutiveFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxConsecutiveFailures
 	}
+
+	nightInterval := cfg.NightInterval
+	if nightInterval <= 0 {
+		nightInterval = defaultNightInterval
+	}
+
+	location := cfg.Location
+	if location == nil {
+		location = time.Local
+	}
+
+	return &Collector{
+		client:  cfg.Client,
+		sungrow: sungrow,
+		bus:     bus,
+		energy:  cfg.Energy,
+		schedule: Schedule{
+			Producing:         cfg.Interval,
+			Asleep:            cfg.AsleepInterval,
+			OfflineBackoff:    cfg.OfflineBackoff,
+			OfflineMaxBackoff: cfg.OfflineMaxBackoff,
+			Night:             nightInterval,
+			Site:              cfg.Daylight,
+		}.withDefaults(),
+		enabled:         cfg.Enabled,
+		align:           cfg.AlignTimestamps,
+		location:        location,
+		maxFailures:     maxFailures,
+		intervalChanged: make(chan struct{}, 1),
+	}, nil
 }
 
 func (c *Collector) Start(ctx context.Context) error {
 	if !c.enabled {
-		log.Println("Collector is disabled")
+		slog.Info("Collector is disabled")
 		return nil
 	}
 
-	if err := c.client.Connect(); err != nil {
-		return err
-	}
-
 	c.mu.Lock()
 	c.isCollecting = true
 	c.mu.Unlock()
 
-	log.Printf("Starting collector with interval %s", c.interval)
+	slog.Info("Starting collector", "producing_interval", c.schedule.Producing, "asleep_interval", c.schedule.Asleep,
+		"offline_backoff", c.schedule.OfflineBackoff, "offline_max_backoff", c.schedule.OfflineMaxBackoff)
+	if c.schedule.Site != nil {
+		slog.Info("Polling slowed down at night", "night_interval", c.schedule.Night)
+	}
+
+	// An unreachable inverter at startup is just the offline state; the
+	// first read fails and the backoff takes over
+	if err := c.client.Connect(); err != nil {
+		slog.Warn("Failed to connect to inverter", "err", err)
+	}
 
 	// Initial collection
 	c.collect()
 
-	ticker := time.NewTicker(c.interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(c.nextInterval())
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Collector stopped")
+			slog.Info("Collector stopped")
 			c.mu.Lock()
 			c.isCollecting = false
 			c.mu.Unlock()
 			return nil
-		case <-ticker.C:
+		case <-timer.C:
 			c.collect()
+			next := c.nextInterval()
+			if c.State() == events.StateOffline {
+				slog.Info("Inverter offline, retrying", "in", next.Round(time.Second))
+			}
+			timer.Reset(next)
+		case <-c.intervalChanged:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(c.nextInterval())
 		}
 	}
 }
 
-func (c *Collector) collect() {
+// UpdateInterval changes the producing interval while the collector runs.
+// The pending read is rescheduled with the new interval; the asleep and
+// offline intervals keep their values.
+func (c *Collector) UpdateInterval(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", d)
+	}
+
+	c.mu.Lock()
+	previous := c.schedule.Producing
+	c.schedule.Producing = d
+	c.mu.Unlock()
+
+	select {
+	case c.intervalChanged <- struct{}{}:
+	default:
+		// A wake-up is already pending and will pick up d
+	}
+	slog.Info("Collector interval changed", "from", previous, "to", d)
+	return nil
+}
+
+// Interval returns the producing interval.
+func (c *Collector) Interval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.schedule.Producing
+}
+
+// nextInterval picks the delay before the next read from the state the
+// last read left the inverter in.
+func (c *Collector) nextInterval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.schedule.atNight(c.schedule.next(c.state, c.failures), time.Now())
+}
+
+// collect reads the inverter once, updates the state and publishes the
+// reading. It returns what ReadAllData returned.
+func (c *Collector) collect() (*inverter.InverterData, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
 	data, err := c.sungrow.ReadAllData()
+	if errors.Is(err, inverter.ErrAsleep) {
+		// The connection is fine; keep the asleep state visible without
+		// publishing a reading full of zeros
+		c.mu.Lock()
+		c.latestData = data
+		c.mu.Unlock()
+		c.setState(events.StateAsleep, nil)
+		return data, err
+	}
 	if err != nil {
-		log.Printf("Error reading inverter data: %v", err)
-		// Try to reconnect
-		if reconnErr := c.client.Reconnect(); reconnErr != nil {
-			log.Printf("Failed to reconnect: %v", reconnErr)
+		slog.Warn("Error reading inverter data", "err", err)
+		// Stale values would keep showing production, so the last reading
+		// is replaced by an offline one. Only the transition is published
+		// to keep a single record of the drop in storage and MQTT.
+		c.mu.Lock()
+		var offline *inverter.InverterData
+		if c.latestData != nil && c.latestData.IsOnline {
+			offline = offlineReading(c.latestData, time.Now(), c.location)
+			c.latestData = offline
+		}
+		c.mu.Unlock()
+		if offline != nil {
+			c.bus.Publish(events.ReadingEvent{Data: offline})
+		}
+		c.setState(events.StateOffline, err)
+		c.reconnect()
+		return nil, err
+	}
+
+	if interval := c.Interval(); c.align && interval > 0 {
+		data.Timestamp = data.Timestamp.Round(interval)
+	}
+
+	// Subscribers share data read-only, so derived fields are set first
+	if c.energy != nil {
+		if lifetime, reset, err := c.energy.TrackLifetimeEnergy(data.TotalEnergy); err == nil {
+			data.LifetimeEnergy = lifetime
+			data.CounterReset = reset
+		} else {
+			slog.Error("Error tracking lifetime energy", "err", err)
 		}
-		return
 	}
 
 	c.mu.Lock()
 	c.latestData = data
+	c.lastSuccess = time.Now()
 	c.mu.Unlock()
 
-	// Save to database
-	if c.db != nil {
-		if err := c.db.SaveReading(data); err != nil {
-			log.Printf("Error saving reading: %v", err)
+	c.setState(events.StateOnline, nil)
+	c.bus.Publish(events.ReadingEvent{Data: data})
+
+	slog.Debug("Collected", "power_w", data.TotalActivePower, "daily_kwh", data.DailyEnergy,
+		"total_kwh", data.TotalEnergy, "temperature_c", data.Temperature)
+	return data, nil
+}
+
+// reconnect runs after a failed read. A closed connection is reopened right
+// away. One that looks open but keeps failing is most likely a half-open
+// socket to a dongle that rebooted, so it is dropped and reopened after
+// every maxFailures failures in a row.
+func (c *Collector) reconnect() {
+	if !c.client.IsConnected() {
+		if err := c.client.Connect(); err != nil {
+			slog.Warn("Failed to reconnect", "err", err)
 		}
+		return
 	}
 
-	// Publish to MQTT
-	if c.publisher != nil {
-		if err := c.publisher.Publish(data); err != nil {
-			log.Printf("Error publishing to MQTT: %v", err)
-		}
+	c.mu.RLock()
+	failures := c.failures
+	c.mu.RUnlock()
+	if failures%c.maxFailures != 0 {
+		return
 	}
+	slog.Warn("Inverter not answering on an open connection, forcing a reconnect", "failures", failures)
+	if err := c.client.Reconnect(); err != nil {
+		slog.Warn("Failed to reconnect", "err", err)
+	}
+}
+
+// setState records the inverter state and announces changes on the bus.
+// Consecutive offline reads are counted for the backoff.
+func (c *Collector) setState(state events.State, err error) {
+	c.mu.Lock()
+	previous := c.state
+	c.state = state
+	if state == events.StateOffline {
+		c.failures++
+	} else {
+		c.failures = 0
+	}
+	c.mu.Unlock()
+
+	if previous == state {
+		return
+	}
+	slog.Info("Inverter state changed", "from", previous, "to", state)
+	c.bus.Publish(events.StateChangeEvent{From: previous, To: state, At: time.Now(), Err: err})
+}
+
+// State returns the inverter state as of the last read.
+func (c *Collector) State() events.State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
+}
 
-	log.Printf("Collected: Power=%dW, Daily=%.1fkWh, Total=%.1fkWh, Temp=%.1f°C",
-		data.TotalActivePower, data.DailyEnergy, data.TotalEnergy, data.Temperature)
+// Bus returns the bus the collector publishes on.
+func (c *Collector) Bus() *events.Bus {
+	return c.bus
 }
 
 func (c *Collector) GetLatestData() *inverter.InverterData {
@@ -119,37 +358,62 @@ func (c *Collector) GetLatestData() *inverter.InverterData {
 	return c.latestData
 }
 
+// LastSuccess returns when the collector last read the inverter successfully.
+func (c *Collector) LastSuccess() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastSuccess
+}
+
+// ProbeInverter times a single register read over the collector's existing
+// connection, without opening a second one.
+func (c *Collector) ProbeInverter() (time.Duration, error) {
+	if !c.client.IsConnected() {
+		return 0, fmt.Errorf("modbus client not connected")
+	}
+
+	start := time.Now()
+	_, err := c.client.ReadUint16(c.sungrow.Registers().DeviceTypeCode)
+	return time.Since(start), err
+}
+
+// Fields returns the register groups read every cycle.
+func (c *Collector) Fields() []string {
+	return c.sungrow.Fields()
+}
+
 func (c *Collector) IsCollecting() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return c.isCollecting
 }
 
+// CollectOnce reads the inverter now, outside the schedule, and handles
+// the result like a scheduled read: the state, latest data and subscribers
+// are updated. An asleep inverter returns its data with ErrAsleep.
 func (c *Collector) CollectOnce() (*inverter.InverterData, error) {
 	if !c.client.IsConnected() {
 		if err := c.client.Connect(); err != nil {
 			return nil, err
 		}
 	}
+	return c.collect()
+}
 
-	data, err := c.sungrow.ReadAllData()
-	if err != nil {
-		return nil, err
-	}
-
-	c.mu.Lock()
-	c.latestData = data
-	c.mu.Unlock()
+// SetPowerLimit writes the inverter's power limit (see
+// inverter.Sungrow.SetPowerLimit) between two reads.
+func (c *Collector) SetPowerLimit(percent float64) error {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
 
-	return data, nil
+	if !c.client.IsConnected() {
+		if err := c.client.Connect(); err != nil {
+			return err
+		}
+	}
+	return c.sungrow.SetPowerLimit(percent)
 }
 
 func (c *Collector) Stop() {
 	c.client.Close()
-	if c.publisher != nil {
-		c.publisher.Close()
-	}
-	if c.db != nil {
-		c.db.Close()
-	}
 }
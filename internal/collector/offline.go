@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"time"
+
+	"sungrow-monitor/internal/inverter"
+)
+
+// offlineReading derives what is known about an inverter that stopped
+// answering from its last reading: it produces nothing, while its energy
+// counters keep their values. The daily counter starts over on a new day
+// in loc.
+func offlineReading(last *inverter.InverterData, at time.Time, loc *time.Location) *inverter.InverterData {
+	data := *last
+	data.Timestamp = at
+	data.IsOnline = false
+	data.IsAsleep = false
+	data.Errors = nil
+	data.Diagnostics = nil
+
+	data.TotalActivePower = 0
+	data.ReactivePower = 0
+	data.ApparentPower = 0
+	data.PowerFactor = 0
+	data.EfficiencyPercent = 0
+	data.UtilizationPercent = 0
+	data.TotalDCPower = 0
+	data.MPPT1Current = 0
+	data.MPPT2Current = 0
+	data.MPPT1Power = 0
+	data.MPPT2Power = 0
+	data.GridCurrent = 0
+	data.PhaseACurrent = 0
+	data.PhaseBCurrent = 0
+	data.PhaseCCurrent = 0
+	if data.GridDirection != "" {
+		data.GridDirection = inverter.GridDirectionIdle
+	}
+
+	y1, m1, d1 := last.Timestamp.In(loc).Date()
+	y2, m2, d2 := at.In(loc).Date()
+	if y1 != y2 || m1 != m2 || d1 != d2 {
+		data.DailyEnergy = 0
+	}
+	return &data
+}
@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"sungrow-monitor/internal/inverter"
+)
+
+func TestOfflineReadingResetsDailyEnergyOnLocalDay(t *testing.T) {
+	brt := time.FixedZone("BRT", -3*60*60)
+	tests := []struct {
+		name     string
+		last, at time.Time
+		want     float64
+	}{
+		// 20:00 and 22:00 local fall on different UTC days
+		{"same local day", time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC), time.Date(2024, 6, 2, 1, 0, 0, 0, time.UTC), 12.5},
+		// 23:00 and 00:30 local fall on the same UTC day
+		{"local midnight passed", time.Date(2024, 6, 2, 2, 0, 0, 0, time.UTC), time.Date(2024, 6, 2, 3, 30, 0, 0, time.UTC), 0},
+		// The timestamps' own locations do not matter
+		{"mixed locations", time.Date(2024, 6, 1, 20, 0, 0, 0, brt), time.Date(2024, 6, 2, 1, 0, 0, 0, time.UTC), 12.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last := &inverter.InverterData{Timestamp: tt.last, DailyEnergy: 12.5, TotalEnergy: 4000, TotalActivePower: 800, IsOnline: true}
+
+			got := offlineReading(last, tt.at, brt)
+
+			if got.DailyEnergy != tt.want {
+				t.Errorf("DailyEnergy = %v, want %v", got.DailyEnergy, tt.want)
+			}
+			if got.TotalEnergy != 4000 || got.TotalActivePower != 0 || got.IsOnline {
+				t.Errorf("offline reading = %+v", got)
+			}
+		})
+	}
+}
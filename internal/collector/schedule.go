@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"math/rand"
+	"time"
+
+	"sungrow-monitor/internal/events"
+	"sungrow-monitor/internal/sun"
+)
+
+// Schedule holds the polling interval for each inverter state.
+type Schedule struct {
+	// Producing is used while the inverter answers with real data.
+	Producing time.Duration
+	// Asleep is used while the inverter is in standby, typically at night.
+	Asleep time.Duration
+	// OfflineBackoff is the first retry delay after the inverter stops
+	// answering; it doubles on every further failure up to
+	// OfflineMaxBackoff.
+	OfflineBackoff    time.Duration
+	OfflineMaxBackoff time.Duration
+
+	// Night is used between sunset and sunrise at Site, when Site is set,
+	// unless the state asks for a longer delay. It is cut short at sunrise
+	// so full-rate polling resumes with the sun.
+	Night time.Duration
+	Site  *sun.Site
+}
+
+// backoffJitter is the largest fraction added to an offline delay, so
+// several monitors that lost the same inverter do not retry in lockstep.
+const backoffJitter = 0.1
+
+// withDefaults fills unset durations from Producing, so a schedule with
+// only Producing set polls at a fixed rate as before.
+func (s Schedule) withDefaults() Schedule {
+	if s.Asleep <= 0 {
+		s.Asleep = s.Producing
+	}
+	if s.OfflineBackoff <= 0 {
+		s.OfflineBackoff = s.Producing
+	}
+	if s.OfflineMaxBackoff < s.OfflineBackoff {
+		s.OfflineMaxBackoff = s.OfflineBackoff
+	}
+	return s
+}
+
+// next returns how long to wait before the next read, given the current
+// state and how many reads in a row have failed. Offline delays get up to
+// backoffJitter of random jitter on top.
+func (s Schedule) next(state events.State, failures int) time.Duration {
+	switch state {
+	case events.StateAsleep:
+		return s.Asleep
+	case events.StateOffline:
+		delay := s.OfflineBackoff
+		for i := 1; i < failures && delay < s.OfflineMaxBackoff; i++ {
+			delay *= 2
+		}
+		if delay > s.OfflineMaxBackoff {
+			delay = s.OfflineMaxBackoff
+		}
+		return delay + time.Duration(rand.Float64()*backoffJitter*float64(delay))
+	default:
+		return s.Producing
+	}
+}
+
+// atNight stretches delay to Night while the sun is down at now, without
+// sleeping past the next sunrise.
+func (s Schedule) atNight(delay time.Duration, now time.Time) time.Duration {
+	if s.Site == nil || s.Night <= 0 || s.Site.IsDaylight(now) {
+		return delay
+	}
+	if delay < s.Night {
+		delay = s.Night
+	}
+	if sunrise, ok := s.nextSunrise(now); ok && sunrise.Sub(now) < delay {
+		delay = sunrise.Sub(now)
+	}
+	return delay
+}
+
+// nextSunrise returns the first sunrise after now, if the sun rises today
+// or tomorrow.
+func (s Schedule) nextSunrise(now time.Time) (time.Time, bool) {
+	if sunrise, _, ok := s.Site.Times(now); ok && sunrise.After(now) {
+		return sunrise, true
+	}
+	sunrise, _, ok := s.Site.Times(now.AddDate(0, 0, 1))
+	return sunrise, ok && sunrise.After(now)
+}
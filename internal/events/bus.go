@@ -0,0 +1,143 @@
+// Package events is the in-process bus between the collector, which reads
+// the inverter, and the sinks that store, publish or react to its data.
+package events
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sungrow-monitor/internal/inverter"
+)
+
+// Event is published on the bus; see ReadingEvent and StateChangeEvent.
+type Event interface {
+	event()
+}
+
+// ReadingEvent carries a successful reading. Data is shared between all
+// subscribers and must not be modified.
+type ReadingEvent struct {
+	Data *inverter.InverterData
+}
+
+// State is the collector's view of the inverter.
+type State string
+
+const (
+	StateUnknown State = ""
+	StateOnline  State = "online"
+	StateAsleep  State = "asleep"
+	StateOffline State = "offline"
+)
+
+// StateChangeEvent is published when the inverter moves between states.
+type StateChangeEvent struct {
+	From State
+	To   State
+	At   time.Time
+	// Err is the read error behind a change to StateOffline.
+	Err error
+}
+
+func (ReadingEvent) event()     {}
+func (StateChangeEvent) event() {}
+
+// Bus fans events out to subscribers. Publishing never blocks: a
+// subscriber whose buffer is full misses the event, so one slow sink cannot
+// stall the collector or the other sinks.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the events published after it was created.
+type Subscription struct {
+	name    string
+	ch      chan Event
+	dropped atomic.Uint64
+}
+
+// Subscribe registers a subscriber that can fall behind by up to buffer
+// events before it starts missing them. name identifies it in logs.
+func (b *Bus) Subscribe(name string, buffer int) *Subscription {
+	sub := &Subscription{name: name, ch: make(chan Event, buffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.ch)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes sub and closes its channel.
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Publish delivers event to every subscriber with room for it.
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			dropped := sub.dropped.Add(1)
+			slog.Warn("Event subscriber is falling behind", "subscriber", sub.name, "dropped", dropped)
+		}
+	}
+}
+
+// Close unsubscribes everyone; their channels are closed once drained.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		close(sub.ch)
+	}
+	b.subs = make(map[*Subscription]struct{})
+	b.closed = true
+}
+
+// Events returns the channel the subscriber reads from.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns how many events the subscriber missed.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Consume calls fn for each event until ctx is cancelled or the
+// subscription is closed.
+func Consume(ctx context.Context, sub *Subscription, fn func(Event)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+			fn(event)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sungrow-monitor/internal/inverter"
+)
+
+func reading(power uint32) ReadingEvent {
+	return ReadingEvent{Data: &inverter.InverterData{TotalActivePower: power}}
+}
+
+// receive reads the events buffered in sub without blocking.
+func receive(t *testing.T, sub *Subscription) []Event {
+	t.Helper()
+	var events []Event
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestPublishFansOutToEverySubscriber(t *testing.T) {
+	bus := NewBus()
+	subs := []*Subscription{bus.Subscribe("storage", 4), bus.Subscribe("mqtt", 4), bus.Subscribe("alerts", 4)}
+
+	bus.Publish(reading(100))
+	bus.Publish(StateChangeEvent{From: StateOnline, To: StateOffline})
+
+	for _, sub := range subs {
+		events := receive(t, sub)
+		if len(events) != 2 {
+			t.Fatalf("%s got %d events, want 2", sub.name, len(events))
+		}
+		if got, ok := events[0].(ReadingEvent); !ok || got.Data.TotalActivePower != 100 {
+			t.Errorf("%s: first event = %#v, want the reading", sub.name, events[0])
+		}
+		if got, ok := events[1].(StateChangeEvent); !ok || got.To != StateOffline {
+			t.Errorf("%s: second event = %#v, want the state change", sub.name, events[1])
+		}
+		if sub.Dropped() != 0 {
+			t.Errorf("%s dropped %d events", sub.name, sub.Dropped())
+		}
+	}
+}
+
+func TestPublishDropsForFullSubscriberWithoutBlocking(t *testing.T) {
+	bus := NewBus()
+	slow := bus.Subscribe("slow", 2)
+	fast := bus.Subscribe("fast", 10)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			bus.Publish(reading(uint32(i)))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full subscriber")
+	}
+
+	if got := slow.Dropped(); got != 3 {
+		t.Errorf("slow.Dropped() = %d, want 3", got)
+	}
+	events := receive(t, slow)
+	if len(events) != 2 {
+		t.Fatalf("slow got %d events, want 2", len(events))
+	}
+	// The oldest events are kept, the ones that did not fit are missed
+	for i, event := range events {
+		if got := event.(ReadingEvent).Data.TotalActivePower; got != uint32(i) {
+			t.Errorf("slow event %d has power %d, want %d", i, got, i)
+		}
+	}
+
+	if got := len(receive(t, fast)); got != 5 {
+		t.Errorf("fast got %d events, want 5", got)
+	}
+	if got := fast.Dropped(); got != 0 {
+		t.Errorf("fast.Dropped() = %d, want 0", got)
+	}
+}
+
+func TestCloseDrainsThenClosesChannels(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe("storage", 4)
+	bus.Publish(reading(1))
+	bus.Publish(reading(2))
+
+	bus.Close()
+
+	for want := uint32(1); want <= 2; want++ {
+		event, ok := <-sub.Events()
+		if !ok {
+			t.Fatalf("channel closed before event %d was delivered", want)
+		}
+		if got := event.(ReadingEvent).Data.TotalActivePower; got != want {
+			t.Errorf("event power = %d, want %d", got, want)
+		}
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("channel still open after the buffered events")
+	}
+
+	// Publishing and subscribing after Close are harmless
+	bus.Publish(reading(3))
+	late := bus.Subscribe("late", 1)
+	if _, ok := <-late.Events(); ok {
+		t.Error("subscription made after Close is open")
+	}
+}
+
+func TestConsumeStopsWhenSubscriptionCloses(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe("storage", 4)
+	bus.Publish(reading(1))
+	bus.Publish(reading(2))
+	bus.Close()
+
+	var got []Event
+	done := make(chan struct{})
+	go func() {
+		Consume(context.Background(), sub, func(event Event) { got = append(got, event) })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Consume did not return after Close")
+	}
+	if len(got) != 2 {
+		t.Errorf("Consume saw %d events, want 2", len(got))
+	}
+}
+
+func TestUnsubscribeStopsDelivery(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe("storage", 4)
+	bus.Unsubscribe(sub)
+	bus.Publish(reading(1))
+
+	if _, ok := <-sub.Events(); ok {
+		t.Error("event delivered after Unsubscribe")
+	}
+	// A second Unsubscribe must not close the channel again
+	bus.Unsubscribe(sub)
+}
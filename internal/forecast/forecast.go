@@ -0,0 +1,217 @@
+// Package forecast projects today's end-of-day energy from the historical
+// time-of-day power profile and today's actual production.
+package forecast
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// minProfilePower is the historical power (W) below which a bucket is
+	// treated as night and carries no information about today's weather.
+	minProfilePower = 10.0
+	// maxRatio bounds the performance ratio so a single odd reading against
+	// a thin history cannot explode the projection.
+	maxRatio = 3.0
+)
+
+// Profile is the average power for each time-of-day bucket, starting at
+// midnight.
+type Profile struct {
+	Bucket   time.Duration
+	AvgPower []float64
+	Samples  []int64
+}
+
+// index returns the bucket containing t, or -1 without a usable bucket.
+func (p *Profile) index(t time.Time) int {
+	if p.Bucket <= 0 {
+		return -1
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return int(t.Sub(midnight) / p.Bucket)
+}
+
+// PowerAt returns the historical average power for the bucket containing t.
+func (p *Profile) PowerAt(t time.Time) float64 {
+	i := p.index(t)
+	if i < 0 || i >= len(p.AvgPower) {
+		return 0
+	}
+	return p.AvgPower[i]
+}
+
+// RemainingEnergy returns the energy (kWh) the profile expects between t and
+// midnight, counting only the unelapsed part of the current bucket.
+func (p *Profile) RemainingEnergy(t time.Time) float64 {
+	i := p.index(t)
+	if i < 0 || i >= len(p.AvgPower) {
+		return 0
+	}
+
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	bucketEnd := midnight.Add(time.Duration(i+1) * p.Bucket)
+	wh := p.AvgPower[i] * bucketEnd.Sub(t).Hours()
+	for j := i + 1; j < len(p.AvgPower); j++ {
+		wh += p.AvgPower[j] * p.Bucket.Hours()
+	}
+	return wh / 1000
+}
+
+// Estimate is a projection of today's total energy.
+type Estimate struct {
+	At               time.Time `json:"at"`
+	EnergySoFar      float64   `json:"energy_so_far_kwh"`
+	RemainingHistory float64   `json:"historical_remaining_kwh"`
+	RawRatio         float64   `json:"raw_performance_ratio"`
+	SmoothedRatio    float64   `json:"smoothed_performance_ratio"`
+	RawProjected     float64   `json:"raw_projected_kwh"`
+	Projected        float64   `json:"projected_kwh"`
+}
+
+// Smoother keeps an exponentially decaying average of the performance
+// ratio (actual power / historical power). The weight of an update grows
+// with the time since the previous one, so irregular updates decay the
+// same way as regular ones. State resets at the start of each day.
+type Smoother struct {
+	HalfLife time.Duration
+
+	mu    sync.Mutex
+	day   time.Time
+	last  time.Time
+	ratio float64
+	valid bool
+}
+
+// Update folds a raw ratio observed at t into the running estimate and
+// returns the smoothed value.
+func (s *Smoother) Update(t time.Time, ratio float64) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if !s.valid || !day.Equal(s.day) {
+		s.day = day
+		s.last = t
+		s.ratio = ratio
+		s.valid = true
+		return s.ratio
+	}
+
+	dt := t.Sub(s.last)
+	if dt <= 0 {
+		return s.ratio
+	}
+	alpha := 1 - math.Exp(-math.Ln2*dt.Seconds()/s.HalfLife.Seconds())
+	s.ratio += alpha * (ratio - s.ratio)
+	s.last = t
+	return s.ratio
+}
+
+// Current returns the smoothed ratio for t's day, or 1 when nothing has
+// been observed yet today.
+func (s *Smoother) Current(t time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if !s.valid || !day.Equal(s.day) {
+		return 1
+	}
+	return s.ratio
+}
+
+// Project combines today's production so far with the historical profile
+// for the rest of the day. The raw projection scales the remaining
+// historical energy by the instantaneous performance ratio; the smoothed
+// one uses the decayed ratio kept by s.
+func Project(profile *Profile, s *Smoother, at time.Time, energySoFar, currentPower float64) Estimate {
+	remaining := profile.RemainingEnergy(at)
+	est := Estimate{
+		At:               at,
+		EnergySoFar:      energySoFar,
+		RemainingHistory: remaining,
+	}
+
+	if expected := profile.PowerAt(at); expected >= minProfilePower {
+		est.RawRatio = math.Min(currentPower/expected, maxRatio)
+		est.SmoothedRatio = s.Update(at, est.RawRatio)
+	} else {
+		// Night or an unknown bucket: keep the last daytime ratio.
+		est.SmoothedRatio = s.Current(at)
+		est.RawRatio = est.SmoothedRatio
+	}
+
+	est.RawProjected = energySoFar + est.RawRatio*remaining
+	est.Projected = energySoFar + est.SmoothedRatio*remaining
+	return est
+}
+
+// ProfileSource loads the historical power profile for the days before day.
+type ProfileSource interface {
+	GetPowerProfile(day time.Time, days int, bucket time.Duration, minSamples int64) ([]float64, []int64, error)
+}
+
+// Forecaster projects today's energy, caching the historical profile for the
+// day since it only depends on previous days.
+type Forecaster struct {
+	source     ProfileSource
+	days       int
+	bucket     time.Duration
+	minSamples int64
+	smoother   *Smoother
+
+	mu         sync.Mutex
+	profile    *Profile
+	profileDay time.Time
+}
+
+type Config struct {
+	Source   ProfileSource
+	Days     int
+	Bucket   time.Duration
+	HalfLife time.Duration
+
+	// MinSamples is the number of readings a bucket needs before its
+	// average is trusted; thinner buckets count as no production.
+	MinSamples int64
+}
+
+func NewForecaster(cfg Config) *Forecaster {
+	return &Forecaster{
+		source:     cfg.Source,
+		days:       cfg.Days,
+		bucket:     cfg.Bucket,
+		minSamples: cfg.MinSamples,
+		smoother:   &Smoother{HalfLife: cfg.HalfLife},
+	}
+}
+
+// Today projects the end-of-day energy for the day containing at.
+func (f *Forecaster) Today(at time.Time, energySoFar, currentPower float64) (Estimate, error) {
+	profile, err := f.profileFor(at)
+	if err != nil {
+		return Estimate{}, err
+	}
+	return Project(profile, f.smoother, at, energySoFar, currentPower), nil
+}
+
+func (f *Forecaster) profileFor(at time.Time) (*Profile, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	if f.profile != nil && day.Equal(f.profileDay) {
+		return f.profile, nil
+	}
+
+	avgs, counts, err := f.source.GetPowerProfile(day, f.days, f.bucket, f.minSamples)
+	if err != nil {
+		return nil, err
+	}
+	f.profile = &Profile{Bucket: f.bucket, AvgPower: avgs, Samples: counts}
+	f.profileDay = day
+	return f.profile, nil
+}
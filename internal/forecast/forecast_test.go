@@ -0,0 +1,190 @@
+package forecast
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var day = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// clearSky is a synthetic hourly curve: a sine from 06:00 to 18:00 peaking
+// near 4 kW, dark otherwise.
+func clearSky() *Profile {
+	p := &Profile{Bucket: time.Hour, AvgPower: make([]float64, 24), Samples: make([]int64, 24)}
+	for h := 6; h < 18; h++ {
+		p.AvgPower[h] = 4000 * math.Sin(math.Pi*(float64(h-6)+0.5)/12)
+		p.Samples[h] = 12
+	}
+	return p
+}
+
+// energy returns the energy (kWh) of the hourly curve between the hours
+// from and to, scaled by ratio.
+func energy(p *Profile, from, to int, ratio float64) float64 {
+	var kwh float64
+	for h := from; h < to; h++ {
+		kwh += ratio * p.AvgPower[h] / 1000
+	}
+	return kwh
+}
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+func TestRemainingEnergy(t *testing.T) {
+	p := clearSky()
+
+	if got, want := p.RemainingEnergy(day), energy(p, 0, 24, 1); !near(got, want) {
+		t.Errorf("at midnight = %v kWh, want the whole day, %v", got, want)
+	}
+	// Half of the 12:00 bucket is left, plus the afternoon
+	want := p.AvgPower[12]/2000 + energy(p, 13, 24, 1)
+	if got := p.RemainingEnergy(day.Add(12*time.Hour + 30*time.Minute)); !near(got, want) {
+		t.Errorf("at 12:30 = %v kWh, want %v", got, want)
+	}
+	if got := p.RemainingEnergy(day.Add(20 * time.Hour)); got != 0 {
+		t.Errorf("after sunset = %v kWh, want 0", got)
+	}
+}
+
+func TestProjectFollowsTheDay(t *testing.T) {
+	tests := []struct {
+		name  string
+		ratio float64
+	}{
+		{"like the history", 1},
+		{"overcast", 0.4},
+		{"brighter than the history", 1.2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := clearSky()
+			s := &Smoother{HalfLife: time.Hour}
+			want := energy(p, 0, 24, tt.ratio)
+
+			// Each hour the inverter produces ratio times the historical power
+			for h := 7; h < 17; h++ {
+				at := day.Add(time.Duration(h) * time.Hour)
+				est := Project(p, s, at, energy(p, 0, h, tt.ratio), tt.ratio*p.AvgPower[h])
+
+				if !near(est.RawRatio, tt.ratio) || !near(est.SmoothedRatio, tt.ratio) {
+					t.Errorf("%02d:00: ratios = %v/%v, want %v", h, est.RawRatio, est.SmoothedRatio, tt.ratio)
+				}
+				if !near(est.Projected, want) || !near(est.RawProjected, want) {
+					t.Errorf("%02d:00: projected %v/%v kWh, want %v", h, est.RawProjected, est.Projected, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProjectSmoothsAPassingCloud(t *testing.T) {
+	p := clearSky()
+	s := &Smoother{HalfLife: time.Hour}
+	at := day.Add(10 * time.Hour)
+	Project(p, s, at, energy(p, 0, 10, 1), p.AvgPower[10])
+
+	// One hour later a cloud halves the output
+	at = at.Add(time.Hour)
+	est := Project(p, s, at, energy(p, 0, 11, 1), p.AvgPower[11]/2)
+
+	if !near(est.RawRatio, 0.5) {
+		t.Errorf("RawRatio = %v, want 0.5", est.RawRatio)
+	}
+	// After one half-life the smoothed ratio is halfway between 1 and 0.5
+	if !near(est.SmoothedRatio, 0.75) {
+		t.Errorf("SmoothedRatio = %v, want 0.75", est.SmoothedRatio)
+	}
+	if est.Projected <= est.RawProjected {
+		t.Errorf("Projected %v kWh is not above the raw %v kWh", est.Projected, est.RawProjected)
+	}
+}
+
+func TestProjectCapsTheRatio(t *testing.T) {
+	p := clearSky()
+	// The first light of the day against a thin historical bucket
+	at := day.Add(6 * time.Hour)
+	est := Project(p, &Smoother{HalfLife: time.Hour}, at, 0, 100*p.AvgPower[6])
+
+	if est.RawRatio != maxRatio || est.SmoothedRatio != maxRatio {
+		t.Errorf("ratios = %v/%v, want %v", est.RawRatio, est.SmoothedRatio, maxRatio)
+	}
+}
+
+func TestProjectKeepsTheRatioAtNight(t *testing.T) {
+	p := clearSky()
+	s := &Smoother{HalfLife: time.Hour}
+	Project(p, s, day.Add(16*time.Hour), energy(p, 0, 16, 0.8), 0.8*p.AvgPower[16])
+
+	est := Project(p, s, day.Add(21*time.Hour), energy(p, 0, 24, 0.8), 0)
+
+	if !near(est.SmoothedRatio, 0.8) || !near(est.RawRatio, 0.8) {
+		t.Errorf("ratios = %v/%v, want the last daytime ratio 0.8", est.RawRatio, est.SmoothedRatio)
+	}
+	if want := energy(p, 0, 24, 0.8); !near(est.Projected, want) {
+		t.Errorf("Projected = %v kWh, want the energy produced, %v", est.Projected, want)
+	}
+
+	// Before the first daytime reading of the next day nothing is assumed
+	if got := s.Current(day.AddDate(0, 0, 1).Add(5 * time.Hour)); got != 1 {
+		t.Errorf("next morning ratio = %v, want 1", got)
+	}
+}
+
+// countingSource serves the clear-sky profile and counts the queries.
+type countingSource struct {
+	calls      int
+	minSamples int64
+}
+
+func (c *countingSource) GetPowerProfile(day time.Time, days int, bucket time.Duration, minSamples int64) ([]float64, []int64, error) {
+	c.calls++
+	c.minSamples = minSamples
+	p := clearSky()
+	return p.AvgPower, p.Samples, nil
+}
+
+func TestForecasterLoadsTheProfileOncePerDay(t *testing.T) {
+	source := &countingSource{}
+	f := NewForecaster(Config{Source: source, Days: 14, Bucket: time.Hour, HalfLife: time.Hour, MinSamples: 3})
+	p := clearSky()
+
+	for h := 8; h < 12; h++ {
+		est, err := f.Today(day.Add(time.Duration(h)*time.Hour), energy(p, 0, h, 1), p.AvgPower[h])
+		if err != nil {
+			t.Fatalf("Today: %v", err)
+		}
+		if want := energy(p, 0, 24, 1); !near(est.Projected, want) {
+			t.Errorf("%02d:00: Projected = %v kWh, want %v", h, est.Projected, want)
+		}
+	}
+	if source.calls != 1 {
+		t.Errorf("profile loaded %d times, want 1", source.calls)
+	}
+	if source.minSamples != 3 {
+		t.Errorf("profile loaded with min samples %d, want 3", source.minSamples)
+	}
+
+	if _, err := f.Today(day.AddDate(0, 0, 1).Add(8*time.Hour), 0, 0); err != nil {
+		t.Fatalf("Today: %v", err)
+	}
+	if source.calls != 2 {
+		t.Errorf("profile loaded %d times after midnight, want 2", source.calls)
+	}
+}
+
+func TestZeroBucketProjectsNothingRemaining(t *testing.T) {
+	p := &Profile{Bucket: 0, AvgPower: clearSky().AvgPower}
+	at := day.Add(10 * time.Hour)
+
+	if got := p.PowerAt(at); got != 0 {
+		t.Errorf("PowerAt = %v, want 0", got)
+	}
+	est := Project(p, &Smoother{HalfLife: time.Hour}, at, 5, 2000)
+	if est.RemainingHistory != 0 || est.Projected != 5 {
+		t.Errorf("estimate = %+v, want only the energy so far", est)
+	}
+}
@@ -0,0 +1,68 @@
+package inverter
+
+// Capabilities describes which data a model can report.
+type Capabilities struct {
+	Model      string `json:"model"`
+	Phases     int    `json:"phases"`
+	MPPTCount  int    `json:"mppt_count"`
+	HasBattery bool   `json:"has_battery"`
+	HasMeter   bool   `json:"has_meter"`
+}
+
+// DefaultModel is the inverter this tool was written for, used when no model
+// is configured.
+const DefaultModel = "SG5.0RS-S"
+
+// defaultCapabilities matches DefaultModel and is used when the device type
+// code is not in the registry.
+var defaultCapabilities = Capabilities{
+	Model:     DefaultModel,
+	Phases:    1,
+	MPPTCount: 2,
+}
+
+// capabilityRegistry maps Sungrow device type codes (register 5000) to the
+// capabilities of the model.
+var capabilityRegistry = map[uint16]Capabilities{
+	0x243D: {Model: "SG3.0RS", Phases: 1, MPPTCount: 2},
+	0x243E: {Model: "SG4.0RS", Phases: 1, MPPTCount: 2},
+	0x2430: {Model: "SG5.0RS", Phases: 1, MPPTCount: 2},
+	0x2431: {Model: "SG6.0RS", Phases: 1, MPPTCount: 2},
+	0x0E00: {Model: "SH5.0RT", Phases: 3, MPPTCount: 2, HasBattery: true, HasMeter: true},
+	0x0E01: {Model: "SH6.0RT", Phases: 3, MPPTCount: 2, HasBattery: true, HasMeter: true},
+	0x0E02: {Model: "SH8.0RT", Phases: 3, MPPTCount: 2, HasBattery: true, HasMeter: true},
+	0x0E03: {Model: "SH10RT", Phases: 3, MPPTCount: 2, HasBattery: true, HasMeter: true},
+}
+
+// DefaultCapabilities returns the capabilities assumed before a device has
+// been identified.
+func DefaultCapabilities() Capabilities {
+	return defaultCapabilities
+}
+
+// LookupCapabilities returns the registry entry for a device type code.
+func LookupCapabilities(deviceType uint16) (Capabilities, bool) {
+	caps, ok := capabilityRegistry[deviceType]
+	return caps, ok
+}
+
+// DetectCapabilities resolves the capabilities of the inverter that produced
+// data. The phase count reported by the output type register wins over the
+// registry since it reflects how the unit is actually wired.
+func DetectCapabilities(data *InverterData) Capabilities {
+	caps, ok := LookupCapabilities(data.DeviceTypeCode)
+	if !ok {
+		caps = defaultCapabilities
+		if data.Model != "" {
+			caps.Model = data.Model
+		}
+	}
+
+	switch data.OutputType {
+	case GetOutputTypeString(OutputSinglePhase):
+		caps.Phases = 1
+	case GetOutputTypeString(Output3P4L), GetOutputTypeString(Output3P3L):
+		caps.Phases = 3
+	}
+	return caps
+}
@@ -0,0 +1,32 @@
+package inverter
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+)
+
+// SetPowerLimit caps the AC output at percent of the nominal power, e.g. to
+// stop exporting while energy prices are negative; 100 restores full
+// output. The limitation switch is enabled first, since the inverter
+// ignores the setting while it is off. The limit is kept by the inverter
+// across restarts of the monitor.
+func (s *Sungrow) SetPowerLimit(percent float64) error {
+	if math.IsNaN(percent) || percent < 0 || percent > 100 {
+		return fmt.Errorf("power limit must be between 0 and 100%%, got %g", percent)
+	}
+	if s.regs.PowerLimitSwitch == 0 || s.regs.PowerLimit == 0 {
+		return fmt.Errorf("power limit: %w", errUnmapped)
+	}
+
+	if err := s.client.WriteUint16(s.regs.PowerLimitSwitch, PowerLimitEnable); err != nil {
+		return fmt.Errorf("failed to enable power limitation: %w", err)
+	}
+	setting := uint16(math.Round(percent * 10))
+	if err := s.client.WriteUint16(s.regs.PowerLimit, setting); err != nil {
+		return fmt.Errorf("failed to set power limit: %w", err)
+	}
+
+	slog.Info("Power limit set", "percent", float64(setting)/10)
+	return nil
+}
@@ -0,0 +1,60 @@
+package inverter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Register groups that can be selected with inverter.fields.
+const (
+	FieldDeviceInfo = "device_info"
+	FieldEnergy     = "energy"
+	FieldMPPT       = "mppt"
+	FieldGrid       = "grid"
+	FieldPower      = "power"
+	FieldStatus     = "status"
+)
+
+// AllFields lists every register group in the order they are read.
+var AllFields = []string{FieldDeviceInfo, FieldEnergy, FieldMPPT, FieldGrid, FieldPower, FieldStatus}
+
+// fieldSet is the set of register groups read on every cycle.
+type fieldSet map[string]bool
+
+// ParseFields validates a list of register group names. An empty list
+// selects every group.
+func ParseFields(names []string) (fieldSet, error) {
+	if len(names) == 0 {
+		names = AllFields
+	}
+
+	set := make(fieldSet, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !isField(name) {
+			return nil, fmt.Errorf("unknown inverter field %q (valid: %s)", name, strings.Join(AllFields, ", "))
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+// list returns the selected groups in AllFields order.
+func (f fieldSet) list() []string {
+	names := make([]string, 0, len(f))
+	for _, field := range AllFields {
+		if f[field] {
+			names = append(names, field)
+		}
+	}
+	return names
+}
+
+func isField(name string) bool {
+	for _, field := range AllFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
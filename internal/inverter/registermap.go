@@ -0,0 +1,288 @@
+package inverter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"sungrow-monitor/internal/modbus"
+)
+
+// RegisterMap holds the Modbus addresses ReadAllData reads. Address 0 marks
+// a register the model does not have: its field is left empty. The three
+// phase voltages and the three phase currents are read as blocks starting
+// at PhaseAVoltage and PhaseACurrent.
+type RegisterMap struct {
+	SerialNumber   uint16
+	DeviceTypeCode uint16
+	NominalPower   uint16
+	OutputType     uint16
+
+	DailyEnergy       uint16
+	TotalEnergy       uint16
+	InsideTemperature uint16
+
+	MPPT1Voltage uint16
+	MPPT1Current uint16
+	MPPT2Voltage uint16
+	MPPT2Current uint16
+	TotalDCPower uint16
+
+	PhaseAVoltage uint16
+	GridFrequency uint16
+	PhaseACurrent uint16
+
+	TotalActivePower   uint16
+	ReactivePower      uint16
+	PowerFactor        uint16
+	TotalApparentPower uint16
+	// SignedActivePower marks TotalActivePower as an S32 register that
+	// goes negative while importing. Only then is GridDirection derived;
+	// neither built-in map has one.
+	SignedActivePower bool
+
+	RunningState uint16
+	FaultCode    uint16
+
+	// PowerLimitSwitch and PowerLimit are holding registers, written by
+	// SetPowerLimit and never read.
+	PowerLimitSwitch uint16
+	PowerLimit       uint16
+}
+
+// DefaultRegisterMap is the map of the SG string inverters, single-phase
+// (RS) and three-phase (RT) alike.
+var DefaultRegisterMap = RegisterMap{
+	SerialNumber:   RegSerialNumber,
+	DeviceTypeCode: RegDeviceTypeCode,
+	NominalPower:   RegNominalPower,
+	OutputType:     RegOutputType,
+
+	DailyEnergy:       RegDailyEnergy,
+	TotalEnergy:       RegTotalEnergy,
+	InsideTemperature: RegInsideTemperature,
+
+	MPPT1Voltage: RegMPPT1Voltage,
+	MPPT1Current: RegMPPT1Current,
+	MPPT2Voltage: RegMPPT2Voltage,
+	MPPT2Current: RegMPPT2Current,
+	TotalDCPower: RegTotalDCPower,
+
+	PhaseAVoltage: RegPhaseAVoltage,
+	GridFrequency: RegGridFrequency,
+	PhaseACurrent: RegPhaseACurrent,
+
+	TotalActivePower:   RegTotalActivePower,
+	ReactivePower:      RegReactivePower,
+	PowerFactor:        RegPowerFactor,
+	TotalApparentPower: RegTotalApparentPower,
+
+	RunningState: RegRunningState,
+	FaultCode:    RegFaultCode,
+
+	PowerLimitSwitch: RegPowerLimitSwitch,
+	PowerLimit:       RegPowerLimitSetting,
+}
+
+// HybridRegisterMap is the map of the SH hybrid inverters. They share the
+// device, energy and MPPT registers with the SG series but report the grid
+// frequency one register later and the inverter's active power and phase
+// currents in the 13000 range. Their running state is a bit field and
+// their fault codes live elsewhere, so both are left unmapped, as is the
+// power limit, which they control through different registers.
+var HybridRegisterMap = RegisterMap{
+	SerialNumber:   RegSerialNumber,
+	DeviceTypeCode: RegDeviceTypeCode,
+	NominalPower:   RegNominalPower,
+	OutputType:     RegOutputType,
+
+	DailyEnergy:       RegDailyEnergy,
+	TotalEnergy:       RegTotalEnergy,
+	InsideTemperature: RegInsideTemperature,
+
+	MPPT1Voltage: RegMPPT1Voltage,
+	MPPT1Current: RegMPPT1Current,
+	MPPT2Voltage: RegMPPT2Voltage,
+	MPPT2Current: RegMPPT2Current,
+	TotalDCPower: RegTotalDCPower,
+
+	PhaseAVoltage: RegPhaseAVoltage,
+	GridFrequency: 5035,  // 5036, U16, 0.1Hz
+	PhaseACurrent: 13030, // 13031-13033, U16, 0.1A
+
+	TotalActivePower: 13033, // 13034-13035, U32, W
+	ReactivePower:    RegReactivePower,
+	PowerFactor:      RegPowerFactor,
+}
+
+// RegisterMapForModel returns the built-in map for a configured model name:
+// the hybrid map for SH models, the default map otherwise.
+func RegisterMapForModel(model string) RegisterMap {
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(model)), "SH") {
+		return HybridRegisterMap
+	}
+	return DefaultRegisterMap
+}
+
+// fields maps the config names of the registers to the map's fields.
+func (m *RegisterMap) fields() map[string]*uint16 {
+	return map[string]*uint16{
+		"serial_number":        &m.SerialNumber,
+		"device_type_code":     &m.DeviceTypeCode,
+		"nominal_power":        &m.NominalPower,
+		"output_type":          &m.OutputType,
+		"daily_energy":         &m.DailyEnergy,
+		"total_energy":         &m.TotalEnergy,
+		"inside_temperature":   &m.InsideTemperature,
+		"mppt1_voltage":        &m.MPPT1Voltage,
+		"mppt1_current":        &m.MPPT1Current,
+		"mppt2_voltage":        &m.MPPT2Voltage,
+		"mppt2_current":        &m.MPPT2Current,
+		"total_dc_power":       &m.TotalDCPower,
+		"phase_a_voltage":      &m.PhaseAVoltage,
+		"grid_frequency":       &m.GridFrequency,
+		"phase_a_current":      &m.PhaseACurrent,
+		"total_active_power":   &m.TotalActivePower,
+		"reactive_power":       &m.ReactivePower,
+		"power_factor":         &m.PowerFactor,
+		"total_apparent_power": &m.TotalApparentPower,
+		"running_state":        &m.RunningState,
+		"fault_code":           &m.FaultCode,
+		"power_limit_switch":   &m.PowerLimitSwitch,
+		"power_limit":          &m.PowerLimit,
+	}
+}
+
+// WithOverrides returns a copy of m with the addresses in overrides, keyed
+// by register name (e.g. total_active_power), replaced. 0 unmaps a
+// register; the serial number cannot be unmapped since reading it is the
+// connectivity test.
+func (m RegisterMap) WithOverrides(overrides map[string]uint16) (RegisterMap, error) {
+	fields := m.fields()
+	for name, address := range overrides {
+		field, ok := fields[name]
+		if !ok {
+			names := make([]string, 0, len(fields))
+			for n := range fields {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return m, fmt.Errorf("unknown register %q (valid: %s)", name, strings.Join(names, ", "))
+		}
+		*field = address
+	}
+	if m.SerialNumber == 0 {
+		return m, errors.New("the serial_number register cannot be unmapped")
+	}
+	return m, nil
+}
+
+// snapshotMaxSpan caps the range read in one snapshot. Registers further
+// from the first one, such as the hybrids' 13000 range, are read on their
+// own.
+const snapshotMaxSpan = 100
+
+// snapshotRegister is a register and how many words it spans.
+type snapshotRegister struct{ address, width uint16 }
+
+// groupRegisters lists the registers each field group reads.
+func (m RegisterMap) groupRegisters() map[string][]snapshotRegister {
+	return map[string][]snapshotRegister{
+		FieldDeviceInfo: {{m.SerialNumber, 10}, {m.DeviceTypeCode, 1}, {m.NominalPower, 1}, {m.OutputType, 1}},
+		FieldEnergy:     {{m.DailyEnergy, 1}, {m.TotalEnergy, 2}, {m.InsideTemperature, 1}},
+		FieldMPPT:       {{m.MPPT1Voltage, 1}, {m.MPPT1Current, 1}, {m.MPPT2Voltage, 1}, {m.MPPT2Current, 1}, {m.TotalDCPower, 2}},
+		FieldGrid:       {{m.PhaseAVoltage, 3}, {m.GridFrequency, 1}, {m.PhaseACurrent, 3}},
+		FieldPower:      {{m.TotalActivePower, 2}, {m.ReactivePower, 2}, {m.PowerFactor, 1}, {m.TotalApparentPower, 2}},
+		FieldStatus:     {{m.RunningState, 1}, {m.FaultCode, 1}},
+	}
+}
+
+// snapshotRange returns the range read at the start of each cycle: from
+// the first mapped register of the selected groups to the end of the last
+// one within snapshotMaxSpan of it. The device info registers are included
+// when deviceInfo is set, since ReadAllData then reads the serial. On the
+// SG map with every group selected that is every register ReadAllData
+// needs, so a single snapshot (two requests with a small
+// max_registers_per_read) replaces some twenty single-register reads. A
+// count of 0 means no selected register is mapped.
+func (m RegisterMap) snapshotRange(fields fieldSet, deviceInfo bool) (start, count uint16) {
+	var registers []snapshotRegister
+	for group, regs := range m.groupRegisters() {
+		if fields[group] || (group == FieldDeviceInfo && deviceInfo) {
+			registers = append(registers, regs...)
+		}
+	}
+
+	for _, r := range registers {
+		if r.address != 0 && (start == 0 || r.address < start) {
+			start = r.address
+		}
+	}
+	end := start
+	for _, r := range registers {
+		if r.address == 0 || int(r.address)+int(r.width)-int(start) > snapshotMaxSpan {
+			continue
+		}
+		if last := r.address + r.width; last > end {
+			end = last
+		}
+	}
+	return start, end - start
+}
+
+// errUnmapped is returned for registers the map leaves at address 0.
+var errUnmapped = errors.New("register not in the register map")
+
+// missingRegister reports whether err means the register does not exist on
+// this inverter, rather than that reading it failed.
+func missingRegister(err error) bool {
+	return errors.Is(err, errUnmapped) || errors.Is(err, modbus.ErrUnsupported) || modbus.IsException(err)
+}
+
+// mappedReader keeps reads of unmapped registers off the wire.
+type mappedReader struct {
+	registerReader
+}
+
+func (r mappedReader) ReadBlock(start, count uint16) ([]uint16, error) {
+	if start == 0 {
+		return nil, errUnmapped
+	}
+	return r.registerReader.ReadBlock(start, count)
+}
+
+func (r mappedReader) ReadUint16(address uint16) (uint16, error) {
+	if address == 0 {
+		return 0, errUnmapped
+	}
+	return r.registerReader.ReadUint16(address)
+}
+
+func (r mappedReader) ReadInt16(address uint16) (int16, error) {
+	if address == 0 {
+		return 0, errUnmapped
+	}
+	return r.registerReader.ReadInt16(address)
+}
+
+func (r mappedReader) ReadUint32(address uint16) (uint32, error) {
+	if address == 0 {
+		return 0, errUnmapped
+	}
+	return r.registerReader.ReadUint32(address)
+}
+
+func (r mappedReader) ReadInt32(address uint16) (int32, error) {
+	if address == 0 {
+		return 0, errUnmapped
+	}
+	return r.registerReader.ReadInt32(address)
+}
+
+func (r mappedReader) ReadString(address uint16, length uint16) (string, error) {
+	if address == 0 {
+		return "", errUnmapped
+	}
+	return r.registerReader.ReadString(address, length)
+}
@@ -0,0 +1,51 @@
+package inverter
+
+import "testing"
+
+func TestSnapshotRangeCoversSelectedGroups(t *testing.T) {
+	tests := []struct {
+		name       string
+		fields     []string
+		deviceInfo bool
+		start, end uint16
+	}{
+		{"every group", nil, true, RegSerialNumber, RegFaultCode + 1},
+		{"status only", []string{FieldStatus}, false, RegRunningState, RegFaultCode + 1},
+		{"power only", []string{FieldPower}, false, RegTotalActivePower, RegTotalApparentPower + 2},
+		{"energy and grid", []string{FieldEnergy, FieldGrid}, false, RegDailyEnergy, RegPhaseCCurrent + 1},
+		// The serial is read on the first cycle even when not selected
+		{"power with the serial", []string{FieldPower}, true, RegSerialNumber, RegTotalApparentPower + 2},
+		{"device info only", []string{FieldDeviceInfo}, false, RegSerialNumber, RegOutputType + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := ParseFields(tt.fields)
+			if err != nil {
+				t.Fatalf("ParseFields: %v", err)
+			}
+			start, count := DefaultRegisterMap.snapshotRange(fields, tt.deviceInfo)
+			if start != tt.start || start+count != tt.end {
+				t.Errorf("range = [%d, %d), want [%d, %d)", start, start+count, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestSnapshotRangeSkipsUnmappedAndDistantRegisters(t *testing.T) {
+	fields, _ := ParseFields([]string{FieldStatus})
+
+	m := DefaultRegisterMap
+	m.RunningState, m.FaultCode = 0, 0
+	if _, count := m.snapshotRange(fields, false); count != 0 {
+		t.Errorf("count = %d with every selected register unmapped, want 0", count)
+	}
+
+	// A register beyond snapshotMaxSpan is left to a read of its own
+	m = DefaultRegisterMap
+	m.FaultCode = m.RunningState + snapshotMaxSpan
+	start, count := m.snapshotRange(fields, false)
+	if start != m.RunningState || count != 1 {
+		t.Errorf("range = [%d, %d), want [%d, %d)", start, start+count, m.RunningState, m.RunningState+1)
+	}
+}
@@ -1,5 +1,7 @@
 package inverter
 
+import "fmt"
+
 // Sungrow Modbus Register Addresses
 // Note: Modbus address = Register number - 1
 
@@ -41,6 +43,16 @@ const (
 	RegRunningState   = 5037 // 5038, U16
 	RegFaultCode      = 5039 // 5040, U16
 	RegNominalReactivePower = 5048 // 5049, S16, 0.1kvar
+
+	// Power Control (Holding Registers)
+	RegPowerLimitSwitch  = 5006 // 5007, U16, PowerLimitEnable/PowerLimitDisable
+	RegPowerLimitSetting = 5007 // 5008, U16, 0.1% of nominal power
+)
+
+// Power limitation switch values
+const (
+	PowerLimitEnable  = 0xAA
+	PowerLimitDisable = 0x55
 )
 
 // Running states
@@ -82,6 +94,64 @@ func GetRunningStateString(state uint16) string {
 	}
 }
 
+// faultDescriptions maps the fault codes documented for Sungrow string
+// inverters to their descriptions.
+var faultDescriptions = map[uint16]string{
+	2:   "Grid overvoltage",
+	3:   "Grid transient overvoltage",
+	4:   "Grid undervoltage",
+	5:   "Grid low undervoltage",
+	7:   "AC transient overcurrent",
+	8:   "Grid overfrequency",
+	9:   "Grid underfrequency",
+	10:  "Grid power outage (islanding)",
+	11:  "Device abnormal",
+	12:  "Excessive leakage current",
+	13:  "Grid abnormal",
+	14:  "10-minute grid overvoltage",
+	15:  "Grid overvoltage",
+	16:  "Output overload",
+	17:  "Grid voltage unbalance",
+	19:  "Bus transient overvoltage",
+	20:  "Bus overvoltage",
+	21:  "PV1 overcurrent",
+	22:  "PV2 overcurrent",
+	23:  "Inverter overcurrent",
+	24:  "Neutral point voltage offset",
+	28:  "PV1 reverse connection",
+	29:  "PV2 reverse connection",
+	36:  "Module over-temperature",
+	37:  "Inverter over-temperature",
+	38:  "Relay fault",
+	39:  "Low insulation resistance",
+	40:  "Power device overcurrent",
+	41:  "Leakage current sampling fault",
+	42:  "Current imbalance",
+	43:  "Ambient temperature too low",
+	44:  "DC/AC inverter circuit fault",
+	45:  "PV boost circuit fault",
+	46:  "PV boost circuit fault",
+	47:  "PV input configuration abnormal",
+	48:  "Phase current sampling fault",
+	53:  "Grid voltage sampling fault",
+	56:  "Insulation resistance detection fault",
+	59:  "Communication fault between master and slave DSP",
+	70:  "Fan fault",
+	87:  "Arc detection device fault",
+	88:  "Arc fault",
+	100: "Grid current sampling fault",
+	106: "Grounding cable fault",
+	116: "Grid relay fault",
+}
+
+// GetFaultString describes a fault code; unknown codes read "Fault <code>".
+func GetFaultString(code uint16) string {
+	if description, ok := faultDescriptions[code]; ok {
+		return description
+	}
+	return fmt.Sprintf("Fault %d", code)
+}
+
 func GetOutputTypeString(outputType uint16) string {
 	switch outputType {
 	case OutputSinglePhase:
@@ -1,7 +1,12 @@
 package inverter
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
 	"time"
 
 	"sungrow-monitor/internal/modbus"
@@ -11,6 +16,7 @@ type InverterData struct {
 	Timestamp time.Time `json:"timestamp"`
 
 	// Device Info
+	Model          string  `json:"model"`
 	SerialNumber   string  `json:"serial_number"`
 	DeviceTypeCode uint16  `json:"device_type_code"`
 	NominalPower   float64 `json:"nominal_power_kw"`
@@ -20,6 +26,16 @@ type InverterData struct {
 	DailyEnergy float64 `json:"daily_energy_kwh"`
 	TotalEnergy float64 `json:"total_energy_kwh"`
 
+	// LifetimeEnergy is TotalEnergy carried across counter rollovers and
+	// inverter replacements. It is filled in by the collector, not read
+	// from the inverter.
+	LifetimeEnergy float64 `json:"lifetime_energy_kwh,omitempty"`
+
+	// CounterReset marks the reading where TotalEnergy dropped below the
+	// highest value seen, so a delta against the previous reading would be
+	// negative; LifetimeEnergy carries on from the old counter.
+	CounterReset bool `json:"counter_reset,omitempty"`
+
 	// Temperature
 	Temperature float64 `json:"temperature_c"`
 
@@ -29,152 +45,555 @@ type InverterData struct {
 	MPPT2Voltage float64 `json:"mppt2_voltage_v"`
 	MPPT2Current float64 `json:"mppt2_current_a"`
 	TotalDCPower uint32  `json:"total_dc_power_w"`
+	// MPPT1Power and MPPT2Power are voltage times current, rounded to
+	// watts; MPPT2Power stays zero on single-MPPT models.
+	MPPT1Power uint32 `json:"mppt1_power_w"`
+	MPPT2Power uint32 `json:"mppt2_power_w"`
 
-	// Grid (single phase for SG5.0RS-S)
+	// Grid. On three-phase units GridVoltage and GridCurrent are the
+	// per-phase averages and the individual phases are filled in.
 	GridVoltage   float64 `json:"grid_voltage_v"`
 	GridFrequency float64 `json:"grid_frequency_hz"`
 	GridCurrent   float64 `json:"grid_current_a"`
+	GridDirection string  `json:"grid_direction,omitempty"`
+	GridPhases    int     `json:"grid_phases"`
+	PhaseAVoltage float64 `json:"phase_a_voltage_v,omitempty"`
+	PhaseBVoltage float64 `json:"phase_b_voltage_v,omitempty"`
+	PhaseCVoltage float64 `json:"phase_c_voltage_v,omitempty"`
+	PhaseACurrent float64 `json:"phase_a_current_a,omitempty"`
+	PhaseBCurrent float64 `json:"phase_b_current_a,omitempty"`
+	PhaseCCurrent float64 `json:"phase_c_current_a,omitempty"`
+	LineVoltage   float64 `json:"line_voltage_v,omitempty"`
 
 	// Power
 	TotalActivePower uint32  `json:"total_active_power_w"`
 	ReactivePower    int32   `json:"reactive_power_var"`
+	ApparentPower    uint32  `json:"apparent_power_va"`
 	PowerFactor      float64 `json:"power_factor"`
+	// EfficiencyPercent is AC output over DC input, set when both are
+	// nonzero.
+	EfficiencyPercent float64 `json:"efficiency_percent,omitempty"`
+	// UtilizationPercent is AC output over the nominal power, clamped to
+	// 0-100, set when the nominal power is known.
+	UtilizationPercent float64 `json:"utilization_percent,omitempty"`
 
 	// Status
 	RunningState       uint16 `json:"running_state"`
 	RunningStateString string `json:"running_state_string"`
 	FaultCode          uint16 `json:"fault_code"`
+	FaultString        string `json:"fault_string,omitempty"`
 	IsOnline           bool   `json:"is_online"`
+	IsAsleep           bool   `json:"is_asleep"`
 	Errors             []string `json:"errors,omitempty"`
+
+	Diagnostics *Diagnostics `json:"diagnostics,omitempty"`
 }
 
+// ErrAsleep is returned when the dongle answers but the inverter behind it
+// is powered down for the night: the serial comes back empty or every
+// register reads zero.
+var ErrAsleep = errors.New("inverter is asleep")
+
 type Sungrow struct {
 	client *modbus.Client
+	model  string
+	fields fieldSet
+	regs   RegisterMap
+
+	mu sync.Mutex
+	// device caches the device info when it is not re-read every cycle.
+	device *deviceInfo
+	// noSnapshot is set once the inverter refuses the snapshot range with
+	// modbus.ExceptionsBeforeUnsupported exceptions in a row, which it
+	// would do again every cycle. Both are reset on a new connection.
+	noSnapshot         bool
+	snapshotExceptions int
+	connection         uint64
+}
+
+// deviceInfo holds the registers that identify the inverter and do not
+// change while it runs.
+type deviceInfo struct {
+	serial       string
+	deviceType   uint16
+	nominalPower uint16
+	outputType   uint16
+	errors       []string
+}
+
+// NewSungrow creates a reader for the inverter behind client. model is
+// reported for devices missing from the capability registry; empty means
+// DefaultModel. fields selects the register groups read every cycle (see
+// ParseFields); empty reads all of them. regs gives the register addresses;
+// the zero value means DefaultRegisterMap.
+func NewSungrow(client *modbus.Client, model string, fields []string, regs RegisterMap) (*Sungrow, error) {
+	if model == "" {
+		model = DefaultModel
+	}
+	if regs == (RegisterMap{}) {
+		regs = DefaultRegisterMap
+	}
+	set, err := ParseFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	// Reading these decides whether the inverter is online
+	client.AlwaysRead(regs.SerialNumber, regs.DeviceTypeCode)
+	return &Sungrow{client: client, model: model, fields: set, regs: regs}, nil
+}
+
+// Registers returns the register map the reader uses.
+func (s *Sungrow) Registers() RegisterMap {
+	return s.regs
 }
 
-func NewSungrow(client *modbus.Client) *Sungrow {
-	return &Sungrow{client: client}
+// Fields returns the register groups read every cycle.
+func (s *Sungrow) Fields() []string {
+	return s.fields.list()
 }
 
+// ReadAllData reads the selected register groups. Device info is always
+// read on the first call; when it is not selected it is cached from then on
+// and the inverter counts as online as long as any other group answers.
 func (s *Sungrow) ReadAllData() (*InverterData, error) {
 	data := &InverterData{
 		Timestamp: time.Now(),
+		Model:     s.model,
 		IsOnline:  false,
 		Errors:    make([]string, 0),
 	}
 
-	// Try to read device info first - this is the connectivity test
-	serial, err := s.client.ReadString(RegSerialNumber, 10)
-	if err != nil {
-		log.Printf("Failed to read serial (inverter may be offline): %v", err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	device := s.device
+	readDevice := device == nil || s.fields[FieldDeviceInfo]
+	r := s.readSnapshot(readDevice)
+
+	answered := false
+	if readDevice {
+		// Reading the serial is the connectivity test
+		info, err := s.readDeviceInfo(r)
+		if errors.Is(err, ErrAsleep) {
+			slog.Debug("Inverter answered with an empty serial, treating it as asleep")
+			data.IsAsleep = true
+			return data, err
+		}
+		if err != nil {
+			slog.Debug("Failed to read serial (inverter may be offline)", "err", err)
+			return data, err
+		}
+		device = info
+		answered = true
+		if !s.fields[FieldDeviceInfo] {
+			s.device = info
+		}
+	}
+	s.applyDeviceInfo(data, device)
+
+	if s.fields[FieldEnergy] {
+		answered = s.readEnergy(r, data) || answered
+	}
+	if s.fields[FieldMPPT] {
+		answered = s.readMPPT(r, data) || answered
+	}
+	if s.fields[FieldGrid] {
+		answered = s.readGrid(r, data, device.outputType) || answered
+	}
+	if s.fields[FieldPower] {
+		answered = s.readPower(r, data) || answered
+	}
+	if s.fields[FieldStatus] {
+		answered = s.readStatus(r, data) || answered
+	} else {
+		data.RunningStateString = "Unknown"
+	}
+
+	// The device info came from the cache and none of the groups answered;
+	// forget it so the next cycle reads the serial again
+	if !answered {
+		s.device = nil
+		err := errors.New("no register group answered")
+		slog.Debug("Failed to read inverter (inverter may be offline)", "err", err)
 		return data, err
 	}
-	data.SerialNumber = serial
+
+	// Without a fresh serial to check, a reading of nothing but zeros is
+	// the only sign that the inverter went to sleep
+	if !s.fields[FieldDeviceInfo] && isZeroResponse(data) {
+		slog.Debug("Inverter answered with all-zero registers, treating it as asleep")
+		data.IsAsleep = true
+		return data, ErrAsleep
+	}
 	data.IsOnline = true
+	sanitize(data)
+
+	if s.fields[FieldPower] {
+		power := s.activePower(data)
+		if s.regs.SignedActivePower {
+			data.GridDirection = GetGridDirection(int32(power))
+		}
+		if data.NominalPower > 0 {
+			data.UtilizationPercent = utilization(math.Abs(power), data.NominalPower)
+		}
+		if s.fields[FieldGrid] {
+			checkGridConsistency(data, power)
+		}
+	}
+	if s.fields[FieldMPPT] {
+		data.MPPT1Power = mpptPower(data.MPPT1Voltage, data.MPPT1Current)
+		if DetectCapabilities(data).MPPTCount >= 2 {
+			data.MPPT2Power = mpptPower(data.MPPT2Voltage, data.MPPT2Current)
+		}
+		data.Diagnostics = checkDCConsistency(data)
+		if s.fields[FieldPower] && data.TotalDCPower > 0 && data.TotalActivePower > 0 {
+			data.EfficiencyPercent = float64(data.TotalActivePower) / float64(data.TotalDCPower) * 100
+		}
+	}
+
+	return data, nil
+}
+
+// registerReader is satisfied by both the modbus Client and a Block read
+// from it, so the group readers work the same with or without a snapshot.
+type registerReader interface {
+	ReadBlock(start, count uint16) ([]uint16, error)
+	ReadUint16(address uint16) (uint16, error)
+	ReadInt16(address uint16) (int16, error)
+	ReadUint32(address uint16) (uint32, error)
+	ReadInt32(address uint16) (int32, error)
+	ReadString(address uint16, length uint16) (string, error)
+}
+
+// readSnapshot reads the snapshot range of the selected groups (see
+// RegisterMap.snapshotRange), with the client's retries. When deviceInfo is
+// set the serial number, whose read decides whether the inverter is
+// online, is part of it, so a one-off glitch does not cost a whole cycle.
+// When every attempt fails the client itself is returned and every group
+// reads its registers one by one, keeping whatever the inverter still
+// answers. A range with registers the model lacks is
+// refused with an exception; once that happened several cycles in a row
+// it is not requested again until the next connection.
+func (s *Sungrow) readSnapshot(deviceInfo bool) registerReader {
+	if connection := s.client.Connections(); connection != s.connection {
+		s.connection = connection
+		s.noSnapshot = false
+		s.snapshotExceptions = 0
+	}
+	if s.noSnapshot {
+		return mappedReader{s.client}
+	}
+	start, count := s.regs.snapshotRange(s.fields, deviceInfo)
+	if count == 0 {
+		return mappedReader{s.client}
+	}
+	block, err := s.client.ReadSnapshot(start, count)
+	if err != nil {
+		if modbus.IsException(err) {
+			s.snapshotExceptions++
+		} else {
+			s.snapshotExceptions = 0
+		}
+		if s.snapshotExceptions >= modbus.ExceptionsBeforeUnsupported {
+			s.noSnapshot = true
+			slog.Warn("Inverter refused the snapshot range, reading registers one by one until it reconnects", "err", err)
+		} else {
+			slog.Warn("Snapshot read failed, reading registers one by one", "err", err)
+		}
+		return mappedReader{s.client}
+	}
+	s.snapshotExceptions = 0
+	return mappedReader{block}
+}
+
+func (s *Sungrow) readDeviceInfo(r registerReader) (*deviceInfo, error) {
+	serial, err := r.ReadString(s.regs.SerialNumber, 10)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(serial) == "" {
+		return nil, ErrAsleep
+	}
+	info := &deviceInfo{serial: serial}
 
 	// Read device type
-	if deviceType, err := s.client.ReadUint16(RegDeviceTypeCode); err == nil {
-		data.DeviceTypeCode = deviceType
+	if deviceType, err := r.ReadUint16(s.regs.DeviceTypeCode); err == nil {
+		info.deviceType = deviceType
 	} else {
-		data.Errors = append(data.Errors, "device_type")
+		info.errors = append(info.errors, "device_type")
 	}
 
 	// Read nominal power
-	if nominalPower, err := s.client.ReadUint16(RegNominalPower); err == nil {
-		data.NominalPower = float64(nominalPower) * 0.1
+	if nominalPower, err := r.ReadUint16(s.regs.NominalPower); err == nil {
+		info.nominalPower = nominalPower
 	} else {
-		data.Errors = append(data.Errors, "nominal_power")
+		info.errors = append(info.errors, "nominal_power")
 	}
 
-	// Read output type
-	if outputType, err := s.client.ReadUint16(RegOutputType); err == nil {
-		data.OutputType = GetOutputTypeString(outputType)
+	// Read output type; it decides which grid registers are meaningful
+	if outputType, err := r.ReadUint16(s.regs.OutputType); err == nil {
+		info.outputType = outputType
 	} else {
-		data.OutputType = "Single Phase" // Default for SG5.0RS-S
+		info.outputType = OutputSinglePhase // Default for the SG5.0RS-S
 	}
 
-	// Read energy data
-	if dailyEnergy, err := s.client.ReadUint16(RegDailyEnergy); err == nil {
+	return info, nil
+}
+
+func (s *Sungrow) applyDeviceInfo(data *InverterData, info *deviceInfo) {
+	data.SerialNumber = info.serial
+	data.DeviceTypeCode = info.deviceType
+	if caps, ok := LookupCapabilities(info.deviceType); ok {
+		data.Model = caps.Model
+	}
+	data.NominalPower = float64(info.nominalPower) * 0.1
+	data.OutputType = GetOutputTypeString(info.outputType)
+	data.Errors = append(data.Errors, info.errors...)
+}
+
+// The group readers below report whether the inverter answered at all.
+
+func (s *Sungrow) readEnergy(r registerReader, data *InverterData) bool {
+	answered := false
+
+	if dailyEnergy, err := r.ReadUint16(s.regs.DailyEnergy); err == nil {
 		data.DailyEnergy = float64(dailyEnergy) * 0.1
+		answered = true
 	} else {
 		data.Errors = append(data.Errors, "daily_energy")
 	}
 
-	if totalEnergy, err := s.client.ReadUint32(RegTotalEnergy); err == nil {
+	if totalEnergy, err := r.ReadUint32(s.regs.TotalEnergy); err == nil {
 		data.TotalEnergy = float64(totalEnergy) * 0.1
+		answered = true
 	} else {
 		data.Errors = append(data.Errors, "total_energy")
 	}
 
 	// Read temperature
-	if temp, err := s.client.ReadInt16(RegInsideTemperature); err == nil {
+	if temp, err := r.ReadInt16(s.regs.InsideTemperature); err == nil {
 		data.Temperature = float64(temp) * 0.1
+		answered = true
 	} else {
 		data.Errors = append(data.Errors, "temperature")
 	}
 
+	return answered
+}
+
+// mpptPower returns the power of an MPPT input in whole watts.
+func mpptPower(voltage, current float64) uint32 {
+	return uint32(math.Round(voltage * current))
+}
+
+// utilization returns power in W as a percentage of nominal in kW. Inverters
+// briefly overshoot their rating, so the result is clamped to 0-100.
+func utilization(power float64, nominal float64) float64 {
+	return math.Min(power/(nominal*1000)*100, 100)
+}
+
+// activePower returns TotalActivePower in W, negative while importing when
+// the register map declares the register signed.
+func (s *Sungrow) activePower(data *InverterData) float64 {
+	if s.regs.SignedActivePower {
+		return float64(int32(data.TotalActivePower))
+	}
+	return float64(data.TotalActivePower)
+}
+
+func (s *Sungrow) readMPPT(r registerReader, data *InverterData) bool {
+	answered := false
+
 	// Read MPPT1 data
-	if mppt1v, err := s.client.ReadUint16(RegMPPT1Voltage); err == nil {
+	if mppt1v, err := r.ReadUint16(s.regs.MPPT1Voltage); err == nil {
 		data.MPPT1Voltage = float64(mppt1v) * 0.1
+		answered = true
 	}
 
-	if mppt1c, err := s.client.ReadUint16(RegMPPT1Current); err == nil {
+	if mppt1c, err := r.ReadUint16(s.regs.MPPT1Current); err == nil {
 		data.MPPT1Current = float64(mppt1c) * 0.01
+		answered = true
 	}
 
 	// Read MPPT2 data (may not exist on all models)
-	if mppt2v, err := s.client.ReadUint16(RegMPPT2Voltage); err == nil {
+	if mppt2v, err := r.ReadUint16(s.regs.MPPT2Voltage); err == nil {
 		data.MPPT2Voltage = float64(mppt2v) * 0.1
+	} else if !missingRegister(err) {
+		data.Errors = append(data.Errors, "mppt2_voltage")
 	}
 
-	if mppt2c, err := s.client.ReadUint16(RegMPPT2Current); err == nil {
+	if mppt2c, err := r.ReadUint16(s.regs.MPPT2Current); err == nil {
 		data.MPPT2Current = float64(mppt2c) * 0.01
+	} else if !missingRegister(err) {
+		data.Errors = append(data.Errors, "mppt2_current")
 	}
 
 	// Read DC power
-	if dcPower, err := s.client.ReadUint32(RegTotalDCPower); err == nil {
+	if dcPower, err := r.ReadUint32(s.regs.TotalDCPower); err == nil {
 		data.TotalDCPower = dcPower
+		answered = true
 	}
 
-	// Read grid data (single phase only for SG5.0RS-S)
-	if gridV, err := s.client.ReadUint16(RegPhaseAVoltage); err == nil {
-		data.GridVoltage = float64(gridV) * 0.1
-	}
+	return answered
+}
 
-	if freq, err := s.client.ReadUint16(RegGridFrequency); err == nil {
+func (s *Sungrow) readGrid(r registerReader, data *InverterData, outputType uint16) bool {
+	answered := false
+	if freq, err := r.ReadUint16(s.regs.GridFrequency); err == nil {
 		data.GridFrequency = float64(freq) * 0.1
+		answered = true
 	}
 
-	if gridC, err := s.client.ReadUint16(RegPhaseACurrent); err == nil {
-		data.GridCurrent = float64(gridC) * 0.1
+	if outputType == Output3P4L || outputType == Output3P3L {
+		s.readThreePhaseGrid(r, data, outputType)
+	} else {
+		s.readSinglePhaseGrid(r, data)
 	}
+	return answered
+}
 
-	// Read power data
-	if activePower, err := s.client.ReadUint32(RegTotalActivePower); err == nil {
+func (s *Sungrow) readPower(r registerReader, data *InverterData) bool {
+	answered := false
+
+	if activePower, err := r.ReadUint32(s.regs.TotalActivePower); err == nil {
 		data.TotalActivePower = activePower
+		answered = true
 	}
 
-	if reactivePower, err := s.client.ReadInt32(RegReactivePower); err == nil {
+	if reactivePower, err := r.ReadInt32(s.regs.ReactivePower); err == nil {
 		data.ReactivePower = reactivePower
+		answered = true
 	}
 
-	if pf, err := s.client.ReadInt16(RegPowerFactor); err == nil {
+	if pf, err := r.ReadInt16(s.regs.PowerFactor); err == nil {
 		data.PowerFactor = float64(pf) * 0.001
+		answered = true
+	}
+
+	if apparentPower, err := r.ReadUint32(s.regs.TotalApparentPower); err == nil {
+		data.ApparentPower = apparentPower
+		answered = true
 	}
 
-	// Read status
-	if state, err := s.client.ReadUint16(RegRunningState); err == nil {
+	return answered
+}
+
+func (s *Sungrow) readStatus(r registerReader, data *InverterData) bool {
+	answered := false
+
+	if state, err := r.ReadUint16(s.regs.RunningState); err == nil {
 		data.RunningState = state
 		data.RunningStateString = GetRunningStateString(state)
+		answered = true
 	} else {
 		data.RunningStateString = "Unknown"
 	}
 
-	if faultCode, err := s.client.ReadUint16(RegFaultCode); err == nil {
+	if faultCode, err := r.ReadUint16(s.regs.FaultCode); err == nil {
 		data.FaultCode = faultCode
+		if faultCode != 0 {
+			data.FaultString = GetFaultString(faultCode)
+		}
+		answered = true
 	}
 
-	return data, nil
+	return answered
+}
+
+func (s *Sungrow) readSinglePhaseGrid(r registerReader, data *InverterData) {
+	data.GridPhases = 1
+
+	if gridV, err := r.ReadUint16(s.regs.PhaseAVoltage); err == nil {
+		data.GridVoltage = float64(gridV) * 0.1
+	}
+
+	if gridC, err := r.ReadUint16(s.regs.PhaseACurrent); err == nil {
+		data.GridCurrent = float64(gridC) * 0.1
+	}
+}
+
+// readThreePhaseGrid reads all three phases. 3P4L units report phase
+// voltages in the voltage registers while 3P3L units, having no neutral,
+// report line-to-line voltages there; GridVoltage is always phase-to-neutral
+// and LineVoltage line-to-line. A phase that could not be read is left at
+// zero and kept out of the averages.
+func (s *Sungrow) readThreePhaseGrid(r registerReader, data *InverterData, outputType uint16) {
+	data.GridPhases = 3
+
+	voltages, ok := s.readBlock(r, s.regs.PhaseAVoltage, 3)
+	phaseVoltages := []*float64{&data.PhaseAVoltage, &data.PhaseBVoltage, &data.PhaseCVoltage}
+	if average, read := averagePhases(data, "voltage", voltages, ok, phaseVoltages); read {
+		if outputType == Output3P3L {
+			data.LineVoltage = average
+			data.GridVoltage = average / math.Sqrt(3)
+		} else {
+			data.GridVoltage = average
+			data.LineVoltage = average * math.Sqrt(3)
+		}
+	} else {
+		data.Errors = append(data.Errors, "grid_voltage")
+	}
+
+	currents, ok := s.readBlock(r, s.regs.PhaseACurrent, 3)
+	phaseCurrents := []*float64{&data.PhaseACurrent, &data.PhaseBCurrent, &data.PhaseCCurrent}
+	if average, read := averagePhases(data, "current", currents, ok, phaseCurrents); read {
+		data.GridCurrent = average
+	} else {
+		data.Errors = append(data.Errors, "grid_current")
+	}
+}
+
+// averagePhases scales the phase registers that were read (0.1 per unit)
+// into fields and returns their average. Missing phases are reported as
+// errors only when at least one phase was read; otherwise the caller
+// reports the whole quantity.
+func averagePhases(data *InverterData, quantity string, regs []uint16, ok []bool, fields []*float64) (float64, bool) {
+	var sum float64
+	var read int
+	var missing []string
+	for i, field := range fields {
+		if !ok[i] {
+			missing = append(missing, fmt.Sprintf("phase_%c_%s", 'a'+i, quantity))
+			continue
+		}
+		*field = float64(regs[i]) * 0.1
+		sum += *field
+		read++
+	}
+	if read == 0 {
+		return 0, false
+	}
+	data.Errors = append(data.Errors, missing...)
+	return sum / float64(read), true
+}
+
+// readBlock reads count contiguous registers in one request. A failed
+// block is retried once; if it fails again each register is read on its
+// own, so a single bad register costs only its own field instead of the
+// whole block. ok reports which registers were read.
+func (s *Sungrow) readBlock(r registerReader, start, count uint16) ([]uint16, []bool) {
+	ok := make([]bool, count)
+
+	regs, err := r.ReadBlock(start, count)
+	if err != nil {
+		regs, err = r.ReadBlock(start, count)
+	}
+	if err == nil {
+		for i := range ok {
+			ok[i] = true
+		}
+		return regs, ok
+	}
+
+	slog.Warn("Block read failed twice, reading registers one by one", "start", start, "count", count, "err", err)
+	regs = make([]uint16, count)
+	for i := uint16(0); i < count; i++ {
+		if value, err := r.ReadUint16(start + i); err == nil {
+			regs[i] = value
+			ok[i] = true
+		}
+	}
+	return regs, ok
 }
 
 func (s *Sungrow) TestConnection() error {
@@ -183,6 +602,6 @@ func (s *Sungrow) TestConnection() error {
 	}
 
 	// Try to read device type as a simple test
-	_, err := s.client.ReadUint16(RegDeviceTypeCode)
+	_, err := s.client.ReadUint16(s.regs.DeviceTypeCode)
 	return err
 }
@@ -0,0 +1,142 @@
+package inverter
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+var errTimeout = errors.New("i/o timeout")
+
+// fakeReader serves registers from a map. The first blockFailures
+// ReadBlock calls fail, as does every read of an address in broken or
+// missing from regs.
+type fakeReader struct {
+	regs          map[uint16]uint16
+	broken        map[uint16]bool
+	blockFailures int
+
+	blockReads  int
+	singleReads int
+}
+
+func (f *fakeReader) ReadBlock(start, count uint16) ([]uint16, error) {
+	f.blockReads++
+	if f.blockFailures > 0 {
+		f.blockFailures--
+		return nil, errTimeout
+	}
+	regs := make([]uint16, count)
+	for i := range regs {
+		value, err := f.ReadUint16(start + uint16(i))
+		if err != nil {
+			return nil, err
+		}
+		f.singleReads--
+		regs[i] = value
+	}
+	return regs, nil
+}
+
+func (f *fakeReader) ReadUint16(address uint16) (uint16, error) {
+	f.singleReads++
+	value, ok := f.regs[address]
+	if !ok || f.broken[address] {
+		return 0, errTimeout
+	}
+	return value, nil
+}
+
+func (f *fakeReader) ReadInt16(address uint16) (int16, error) {
+	value, err := f.ReadUint16(address)
+	return int16(value), err
+}
+
+func (f *fakeReader) ReadUint32(address uint16) (uint32, error) {
+	low, err := f.ReadUint16(address)
+	if err != nil {
+		return 0, err
+	}
+	high, err := f.ReadUint16(address + 1)
+	return uint32(low) | uint32(high)<<16, err
+}
+
+func (f *fakeReader) ReadInt32(address uint16) (int32, error) {
+	value, err := f.ReadUint32(address)
+	return int32(value), err
+}
+
+func (f *fakeReader) ReadString(address uint16, length uint16) (string, error) {
+	return "", errTimeout
+}
+
+// near compares scaled register values, which carry rounding errors.
+func near(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+// phaseVoltages are 230.1, 231.2 and 229.9 V.
+var phaseVoltages = map[uint16]uint16{RegPhaseAVoltage: 2301, RegPhaseAVoltage + 1: 2312, RegPhaseAVoltage + 2: 2299}
+
+func TestReadBlockRetriesOnce(t *testing.T) {
+	r := &fakeReader{regs: phaseVoltages, blockFailures: 1}
+	s := &Sungrow{regs: DefaultRegisterMap}
+
+	regs, ok := s.readBlock(r, RegPhaseAVoltage, 3)
+
+	if r.blockReads != 2 || r.singleReads != 0 {
+		t.Errorf("%d block and %d single reads, want 2 and 0", r.blockReads, r.singleReads)
+	}
+	want := []uint16{2301, 2312, 2299}
+	for i := range want {
+		if !ok[i] || regs[i] != want[i] {
+			t.Errorf("register %d = %d (ok %v), want %d", i, regs[i], ok[i], want[i])
+		}
+	}
+}
+
+func TestReadBlockFallsBackToSingleRegisters(t *testing.T) {
+	r := &fakeReader{regs: phaseVoltages, broken: map[uint16]bool{RegPhaseAVoltage + 1: true}, blockFailures: 2}
+	s := &Sungrow{regs: DefaultRegisterMap}
+
+	regs, ok := s.readBlock(r, RegPhaseAVoltage, 3)
+
+	if r.blockReads != 2 || r.singleReads != 3 {
+		t.Errorf("%d block and %d single reads, want 2 and 3", r.blockReads, r.singleReads)
+	}
+	wantOK := []bool{true, false, true}
+	wantRegs := []uint16{2301, 0, 2299}
+	for i := range wantOK {
+		if ok[i] != wantOK[i] || regs[i] != wantRegs[i] {
+			t.Errorf("register %d = %d (ok %v), want %d (ok %v)", i, regs[i], ok[i], wantRegs[i], wantOK[i])
+		}
+	}
+}
+
+func TestReadThreePhaseGridKeepsPartialValues(t *testing.T) {
+	regs := map[uint16]uint16{
+		RegPhaseACurrent: 101, RegPhaseACurrent + 1: 102, RegPhaseACurrent + 2: 103,
+	}
+	for address, value := range phaseVoltages {
+		regs[address] = value
+	}
+	// The block of voltages fails twice and phase B stays unreadable
+	r := &fakeReader{regs: regs, broken: map[uint16]bool{RegPhaseAVoltage + 1: true}, blockFailures: 2}
+	s := &Sungrow{regs: DefaultRegisterMap}
+	data := &InverterData{}
+
+	s.readThreePhaseGrid(r, data, Output3P4L)
+
+	if !near(data.PhaseAVoltage, 230.1) || data.PhaseBVoltage != 0 || !near(data.PhaseCVoltage, 229.9) {
+		t.Errorf("phase voltages = %v/%v/%v, want 230.1/0/229.9", data.PhaseAVoltage, data.PhaseBVoltage, data.PhaseCVoltage)
+	}
+	if want := (230.1 + 229.9) / 2; !near(data.GridVoltage, want) {
+		t.Errorf("GridVoltage = %v, want the average of the phases read, %v", data.GridVoltage, want)
+	}
+	if !near(data.GridCurrent, 10.2) {
+		t.Errorf("GridCurrent = %v, want 10.2", data.GridCurrent)
+	}
+	if len(data.Errors) != 1 || data.Errors[0] != "phase_b_voltage" {
+		t.Errorf("Errors = %v, want [phase_b_voltage]", data.Errors)
+	}
+}
@@ -0,0 +1,161 @@
+package inverter
+
+import (
+	"log/slog"
+	"math"
+)
+
+// Grid power directions
+const (
+	GridDirectionExport = "export"
+	GridDirectionImport = "import"
+	GridDirectionIdle   = "idle"
+)
+
+// DCDiagnostics compares the DC power reported by the inverter with the
+// power implied by the MPPT voltages and currents.
+type DCDiagnostics struct {
+	CurrentTotal  float64 `json:"dc_current_total_a"`
+	ComputedPower float64 `json:"dc_power_computed_w"`
+	ReportedPower uint32  `json:"dc_power_reported_w"`
+	Mismatch      bool    `json:"dc_power_mismatch"`
+}
+
+// Diagnostics holds derived data-quality checks for a reading.
+type Diagnostics struct {
+	DC DCDiagnostics `json:"dc"`
+}
+
+const (
+	// powerMismatchRatio is the relative difference between reported and
+	// V*I*PF-derived power tolerated before a reading is flagged.
+	powerMismatchRatio = 0.15
+	// powerMismatchFloor avoids flagging small absolute differences at
+	// low power where register resolution dominates.
+	powerMismatchFloor = 100.0
+)
+
+// Bounds outside of which a value can only come from a corrupt frame.
+const (
+	minGridFrequency = 45.0
+	maxGridFrequency = 65.0
+	maxGridVoltage   = 300.0
+	maxLineVoltage   = 520.0 // maxGridVoltage × √3, between two phases
+	minTemperature   = -40.0
+	maxTemperature   = 100.0
+)
+
+// GetGridDirection derives whether power flows to or from the grid from the
+// signed active power. Single-phase grid current is unsigned, so power is
+// the only register that carries the direction; with an unsigned power
+// register (see RegisterMap.SignedActivePower) the direction is unknown.
+func GetGridDirection(activePower int32) string {
+	switch {
+	case activePower > 0:
+		return GridDirectionExport
+	case activePower < 0:
+		return GridDirectionImport
+	default:
+		return GridDirectionIdle
+	}
+}
+
+// isZeroResponse reports whether every measured value in data is zero. A
+// running inverter always reports at least its lifetime energy counter and
+// temperature, so this only happens when the dongle answers for an inverter
+// that is switched off.
+func isZeroResponse(data *InverterData) bool {
+	return data.DailyEnergy == 0 && data.TotalEnergy == 0 && data.Temperature == 0 &&
+		data.MPPT1Voltage == 0 && data.MPPT1Current == 0 &&
+		data.MPPT2Voltage == 0 && data.MPPT2Current == 0 && data.TotalDCPower == 0 &&
+		data.GridVoltage == 0 && data.GridFrequency == 0 && data.GridCurrent == 0 &&
+		data.TotalActivePower == 0 && data.ReactivePower == 0 && data.PowerFactor == 0 &&
+		data.RunningState == 0 && data.FaultCode == 0
+}
+
+// sanitize zeroes values no inverter can report, such as the 6553.5 Hz of
+// a frame of 0xFFFF, and lists them in Errors so they never reach storage.
+// GridVoltage is phase-to-neutral on every model, so one bound covers
+// single- and three-phase units. LineVoltage is line-to-line, and so are
+// the phase voltages of 3P3L units, so those get the line-to-line bound.
+// Reactive power is bounded by the nominal power when the model reported
+// it.
+func sanitize(data *InverterData) {
+	reject := func(field string, value interface{}) {
+		slog.Warn("Discarding impossible value", "field", field, "value", value)
+		data.Errors = append(data.Errors, field)
+	}
+
+	if data.GridFrequency != 0 && (data.GridFrequency < minGridFrequency || data.GridFrequency > maxGridFrequency) {
+		reject("grid_frequency", data.GridFrequency)
+		data.GridFrequency = 0
+	}
+	if data.GridVoltage < 0 || data.GridVoltage > maxGridVoltage {
+		reject("grid_voltage", data.GridVoltage)
+		data.GridVoltage = 0
+		data.LineVoltage = 0
+	}
+	phaseVoltages := []struct {
+		field string
+		value *float64
+	}{
+		{"phase_a_voltage", &data.PhaseAVoltage},
+		{"phase_b_voltage", &data.PhaseBVoltage},
+		{"phase_c_voltage", &data.PhaseCVoltage},
+		{"line_voltage", &data.LineVoltage},
+	}
+	for _, v := range phaseVoltages {
+		if *v.value < 0 || *v.value > maxLineVoltage {
+			reject(v.field, *v.value)
+			*v.value = 0
+		}
+	}
+	if data.Temperature < minTemperature || data.Temperature > maxTemperature {
+		reject("temperature", data.Temperature)
+		data.Temperature = 0
+	}
+	if data.NominalPower > 0 && math.Abs(float64(data.ReactivePower)) > data.NominalPower*1000 {
+		reject("reactive_power", data.ReactivePower)
+		data.ReactivePower = 0
+	}
+}
+
+// checkGridConsistency compares the reported active power against the power
+// implied by grid voltage, current and power factor. A large disagreement
+// usually means a register was misread or scaled wrongly. activePower is
+// TotalActivePower with its sign, if the register has one.
+func checkGridConsistency(data *InverterData, activePower float64) {
+	if activePower == 0 || data.GridVoltage == 0 || data.GridCurrent == 0 {
+		return
+	}
+
+	phases := float64(data.GridPhases)
+	if phases == 0 {
+		phases = 1
+	}
+	derived := phases * data.GridVoltage * data.GridCurrent * math.Abs(data.PowerFactor)
+	diff := math.Abs(math.Abs(activePower) - derived)
+	if diff > powerMismatchFloor && diff > math.Abs(activePower)*powerMismatchRatio {
+		slog.Warn("Grid readings disagree", "active_power_w", activePower, "derived_power_w", math.Round(derived),
+			"voltage_v", data.GridVoltage, "current_a", data.GridCurrent, "power_factor", data.PowerFactor)
+	}
+}
+
+// checkDCConsistency sums the MPPT strings and flags a reading whose total
+// DC power is far from the reported value, which points at a misread
+// register or a string the inverter does not report.
+func checkDCConsistency(data *InverterData) *Diagnostics {
+	dc := DCDiagnostics{
+		CurrentTotal:  data.MPPT1Current + data.MPPT2Current,
+		ComputedPower: data.MPPT1Voltage*data.MPPT1Current + data.MPPT2Voltage*data.MPPT2Current,
+		ReportedPower: data.TotalDCPower,
+	}
+
+	diff := math.Abs(dc.ComputedPower - float64(dc.ReportedPower))
+	if diff > powerMismatchFloor && diff > float64(dc.ReportedPower)*powerMismatchRatio {
+		dc.Mismatch = true
+		slog.Warn("DC readings disagree", "reported_w", dc.ReportedPower, "mppt_w", math.Round(dc.ComputedPower))
+	}
+
+	return &Diagnostics{DC: dc}
+}
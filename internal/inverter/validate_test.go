@@ -0,0 +1,81 @@
+package inverter
+
+import "testing"
+
+func TestIsZeroResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(*InverterData)
+	}{
+		{"daily energy", func(d *InverterData) { d.DailyEnergy = 0.1 }},
+		{"total energy", func(d *InverterData) { d.TotalEnergy = 1 }},
+		{"temperature", func(d *InverterData) { d.Temperature = -2.5 }},
+		{"mppt1 voltage", func(d *InverterData) { d.MPPT1Voltage = 0.1 }},
+		{"mppt1 current", func(d *InverterData) { d.MPPT1Current = 0.1 }},
+		{"mppt2 voltage", func(d *InverterData) { d.MPPT2Voltage = 0.1 }},
+		{"mppt2 current", func(d *InverterData) { d.MPPT2Current = 0.1 }},
+		{"dc power", func(d *InverterData) { d.TotalDCPower = 1 }},
+		{"grid voltage", func(d *InverterData) { d.GridVoltage = 0.1 }},
+		{"grid frequency", func(d *InverterData) { d.GridFrequency = 0.1 }},
+		{"grid current", func(d *InverterData) { d.GridCurrent = 0.1 }},
+		{"active power", func(d *InverterData) { d.TotalActivePower = 1 }},
+		{"reactive power", func(d *InverterData) { d.ReactivePower = -1 }},
+		{"power factor", func(d *InverterData) { d.PowerFactor = 0.001 }},
+		{"running state", func(d *InverterData) { d.RunningState = 1 }},
+		{"fault code", func(d *InverterData) { d.FaultCode = 1 }},
+	}
+
+	if !isZeroResponse(&InverterData{}) {
+		t.Error("all zeros: inverter not reported asleep")
+	}
+	// Identity and bookkeeping fields are not measurements
+	if !isZeroResponse(&InverterData{SerialNumber: "A1", DeviceTypeCode: 0x2C0F, Errors: []string{"temperature"}}) {
+		t.Error("zeros with device info: inverter not reported asleep")
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &InverterData{}
+			tt.set(data)
+			if isZeroResponse(data) {
+				t.Errorf("%s alone is non-zero but the inverter was reported asleep", tt.name)
+			}
+		})
+	}
+}
+
+func TestSanitizeVoltages(t *testing.T) {
+	tests := []struct {
+		name  string
+		set   func(*InverterData)
+		field string
+		get   func(*InverterData) float64
+	}{
+		{"grid voltage", func(d *InverterData) { d.GridVoltage = 6553.5 }, "grid_voltage", func(d *InverterData) float64 { return d.GridVoltage }},
+		{"phase a voltage", func(d *InverterData) { d.PhaseAVoltage = 6553.5 }, "phase_a_voltage", func(d *InverterData) float64 { return d.PhaseAVoltage }},
+		{"phase b voltage", func(d *InverterData) { d.PhaseBVoltage = 6553.5 }, "phase_b_voltage", func(d *InverterData) float64 { return d.PhaseBVoltage }},
+		{"phase c voltage", func(d *InverterData) { d.PhaseCVoltage = -1 }, "phase_c_voltage", func(d *InverterData) float64 { return d.PhaseCVoltage }},
+		{"line voltage", func(d *InverterData) { d.LineVoltage = 6553.5 }, "line_voltage", func(d *InverterData) float64 { return d.LineVoltage }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &InverterData{GridVoltage: 230, PhaseAVoltage: 230, PhaseBVoltage: 231, PhaseCVoltage: 229, LineVoltage: 398.4}
+			tt.set(data)
+			sanitize(data)
+			if got := tt.get(data); got != 0 {
+				t.Errorf("%s = %v, want 0", tt.field, got)
+			}
+			if len(data.Errors) == 0 || data.Errors[0] != tt.field {
+				t.Errorf("Errors = %v, want %s", data.Errors, tt.field)
+			}
+		})
+	}
+
+	// 3P3L units report line-to-line voltages in the phase registers
+	data := &InverterData{GridVoltage: 230.9, PhaseAVoltage: 400, PhaseBVoltage: 401, PhaseCVoltage: 399, LineVoltage: 400}
+	sanitize(data)
+	if len(data.Errors) != 0 || data.PhaseAVoltage != 400 || data.LineVoltage != 400 {
+		t.Errorf("valid 3P3L voltages rejected: %+v", data)
+	}
+}
@@ -0,0 +1,80 @@
+package modbus
+
+// Block holds a contiguous range of input registers fetched with as few
+// requests as possible. Its Read methods mirror the Client's: addresses
+// inside the range are served from memory, anything else goes to the
+// Client, so callers can use either interchangeably.
+type Block struct {
+	client *Client
+	start  uint16
+	regs   []uint16
+}
+
+// ReadSnapshot reads count input registers starting at start into a Block,
+// retrying each request as ReadInputRegistersRetry does.
+func (c *Client) ReadSnapshot(start, count uint16) (*Block, error) {
+	regs, err := c.readBlock(start, count, c.ReadInputRegistersRetry)
+	if err != nil {
+		return nil, err
+	}
+	return &Block{client: c, start: start, regs: regs}, nil
+}
+
+// slice returns the quantity registers at address, or false when they are
+// not all inside the block.
+func (b *Block) slice(address, quantity uint16) ([]uint16, bool) {
+	if address < b.start {
+		return nil, false
+	}
+	offset := int(address - b.start)
+	if offset+int(quantity) > len(b.regs) {
+		return nil, false
+	}
+	return b.regs[offset : offset+int(quantity)], true
+}
+
+func (b *Block) ReadBlock(start, count uint16) ([]uint16, error) {
+	if regs, ok := b.slice(start, count); ok {
+		out := make([]uint16, count)
+		copy(out, regs)
+		return out, nil
+	}
+	return b.client.ReadBlock(start, count)
+}
+
+func (b *Block) ReadUint16(address uint16) (uint16, error) {
+	if regs, ok := b.slice(address, 1); ok {
+		return regs[0], nil
+	}
+	return b.client.ReadUint16(address)
+}
+
+func (b *Block) ReadInt16(address uint16) (int16, error) {
+	val, err := b.ReadUint16(address)
+	if err != nil {
+		return 0, err
+	}
+	return int16(val), nil
+}
+
+func (b *Block) ReadUint32(address uint16) (uint32, error) {
+	if regs, ok := b.slice(address, 2); ok {
+		return b.client.wordOrder.Uint32(regs), nil
+	}
+	return b.client.ReadUint32(address)
+}
+
+func (b *Block) ReadInt32(address uint16) (int32, error) {
+	val, err := b.ReadUint32(address)
+	if err != nil {
+		return 0, err
+	}
+	return int32(val), nil
+}
+
+func (b *Block) ReadString(address uint16, length uint16) (string, error) {
+	if regs, ok := b.slice(address, length); ok {
+		return decodeString(regs), nil
+	}
+	return b.client.ReadString(address, length)
+}
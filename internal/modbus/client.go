@@ -2,27 +2,118 @@ package modbus
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/simonvetter/modbus"
 )
 
+// WordOrder is the order in which a 32-bit value is split across two
+// registers. Sungrow documents low word first, but some firmware revisions
+// and models send the high word first.
+type WordOrder string
+
+const (
+	WordOrderLowHigh WordOrder = "lowhigh"
+	WordOrderHighLow WordOrder = "highlow"
+)
+
+// ParseWordOrder validates a configured word order; empty means
+// WordOrderLowHigh.
+func ParseWordOrder(s string) (WordOrder, error) {
+	switch order := WordOrder(strings.ToLower(s)); order {
+	case "":
+		return WordOrderLowHigh, nil
+	case WordOrderLowHigh, WordOrderHighLow:
+		return order, nil
+	default:
+		return "", fmt.Errorf("unknown word order %q (want %q or %q)", s, WordOrderLowHigh, WordOrderHighLow)
+	}
+}
+
+// Uint32 combines two registers in this word order.
+func (o WordOrder) Uint32(regs []uint16) uint32 {
+	if o == WordOrderHighLow {
+		return uint32(regs[0])<<16 | uint32(regs[1])
+	}
+	return uint32(regs[0]) | uint32(regs[1])<<16
+}
+
+// DefaultMaxRegistersPerRead is accepted by every dongle firmware we know
+// of; the Modbus protocol itself allows up to 125.
+const DefaultMaxRegistersPerRead = 64
+
+// transport is the part of *modbus.ModbusClient the Client uses, so tests
+// can stand in for an inverter.
+type transport interface {
+	ReadRegisters(address, quantity uint16, regType modbus.RegType) ([]uint16, error)
+	WriteRegister(address, value uint16) error
+	Close() error
+}
+
 type Client struct {
-	client  *modbus.ModbusClient
+	client  transport
 	mu      sync.Mutex
 	ip      string
 	port    int
 	slaveID uint8
 	timeout time.Duration
+
+	maxRegistersPerRead uint16
+	wordOrder           WordOrder
+	retryCount          int
+	retryDelay          time.Duration
+
+	// unsupported holds the addresses the inverter kept answering with
+	// an exception, exceptions the count of consecutive ones so far and
+	// alwaysRead the addresses never skipped; see readRegisters.
+	unsupported map[uint16]bool
+	exceptions  map[uint16]int
+	alwaysRead  map[uint16]bool
+	// connections counts the connections opened, see Connections.
+	connections uint64
 }
 
-func NewClient(ip string, port int, slaveID uint8, timeout time.Duration) *Client {
+type ClientConfig struct {
+	IP      string
+	Port    int
+	SlaveID uint8
+	Timeout time.Duration
+
+	// MaxRegistersPerRead caps the registers requested in a single PDU by
+	// ReadBlock. Zero means DefaultMaxRegistersPerRead.
+	MaxRegistersPerRead uint16
+	// WordOrder decodes ReadUint32 and ReadInt32. Empty means
+	// WordOrderLowHigh.
+	WordOrder WordOrder
+
+	// RetryCount is how many more times ReadInputRegistersRetry and
+	// ReadSnapshot try a failed read, waiting RetryDelay in between.
+	RetryCount int
+	RetryDelay time.Duration
+}
+
+func NewClient(cfg ClientConfig) *Client {
+	maxRegs := cfg.MaxRegistersPerRead
+	if maxRegs == 0 {
+		maxRegs = DefaultMaxRegistersPerRead
+	}
+	wordOrder := cfg.WordOrder
+	if wordOrder == "" {
+		wordOrder = WordOrderLowHigh
+	}
+
 	return &Client{
-		ip:      ip,
-		port:    port,
-		slaveID: slaveID,
-		timeout: timeout,
+		ip:      cfg.IP,
+		port:    cfg.Port,
+		slaveID: cfg.SlaveID,
+		timeout: cfg.Timeout,
+
+		maxRegistersPerRead: maxRegs,
+		wordOrder:           wordOrder,
+		retryCount:          cfg.RetryCount,
+		retryDelay:          cfg.RetryDelay,
 	}
 }
 
@@ -48,6 +139,12 @@ func (c *Client) Connect() error {
 
 	client.SetUnitId(c.slaveID)
 	c.client = client
+	c.connections++
+
+	// Exceptions can come from a dongle in a bad state rather than the
+	// model, so a new connection gets to try every register again
+	c.unsupported = nil
+	c.exceptions = nil
 
 	return nil
 }
@@ -65,6 +162,11 @@ func (c *Client) Close() error {
 	return err
 }
 
+// WordOrder returns the order used to decode 32-bit values.
+func (c *Client) WordOrder() WordOrder {
+	return c.wordOrder
+}
+
 func (c *Client) IsConnected() bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -87,6 +189,18 @@ func (c *Client) ReadInputRegisters(address uint16, quantity uint16) ([]uint16,
 	return regs, nil
 }
 
+// ReadInputRegistersRetry is ReadInputRegisters retried up to RetryCount
+// times, so that a one-off glitch on the link does not fail the read. An
+// exception is not retried since the inverter would refuse again.
+func (c *Client) ReadInputRegistersRetry(address uint16, quantity uint16) ([]uint16, error) {
+	regs, err := c.ReadInputRegisters(address, quantity)
+	for attempt := 0; err != nil && !IsException(err) && attempt < c.retryCount; attempt++ {
+		time.Sleep(c.retryDelay)
+		regs, err = c.ReadInputRegisters(address, quantity)
+	}
+	return regs, err
+}
+
 func (c *Client) ReadHoldingRegisters(address uint16, quantity uint16) ([]uint16, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -103,8 +217,63 @@ func (c *Client) ReadHoldingRegisters(address uint16, quantity uint16) ([]uint16
 	return regs, nil
 }
 
+// WriteUint16 writes value to the holding register at address.
+func (c *Client) WriteUint16(address, value uint16) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		return fmt.Errorf("client not connected")
+	}
+
+	if err := c.client.WriteRegister(address, value); err != nil {
+		return fmt.Errorf("failed to write holding register at %d: %w", address, err)
+	}
+
+	return nil
+}
+
+// ReadBlock reads count contiguous input registers starting at start,
+// splitting the range into as many requests as MaxRegistersPerRead needs.
+func (c *Client) ReadBlock(start, count uint16) ([]uint16, error) {
+	return c.readBlock(start, count, c.ReadInputRegisters)
+}
+
+func (c *Client) readBlock(start, count uint16, read func(address, quantity uint16) ([]uint16, error)) ([]uint16, error) {
+	regs := make([]uint16, 0, count)
+	for _, chunk := range splitRange(start, count, c.maxRegistersPerRead) {
+		part, err := read(chunk.start, chunk.count)
+		if err != nil {
+			return nil, err
+		}
+		regs = append(regs, part...)
+	}
+	return regs, nil
+}
+
+type registerRange struct {
+	start uint16
+	count uint16
+}
+
+// splitRange divides [start, start+count) into consecutive ranges of at
+// most max registers.
+func splitRange(start, count, max uint16) []registerRange {
+	var ranges []registerRange
+	for count > 0 {
+		n := count
+		if n > max {
+			n = max
+		}
+		ranges = append(ranges, registerRange{start: start, count: n})
+		start += n
+		count -= n
+	}
+	return ranges
+}
+
 func (c *Client) ReadUint16(address uint16) (uint16, error) {
-	regs, err := c.ReadInputRegisters(address, 1)
+	regs, err := c.readRegisters(address, 1)
 	if err != nil {
 		return 0, err
 	}
@@ -112,7 +281,7 @@ func (c *Client) ReadUint16(address uint16) (uint16, error) {
 }
 
 func (c *Client) ReadInt16(address uint16) (int16, error) {
-	regs, err := c.ReadInputRegisters(address, 1)
+	regs, err := c.readRegisters(address, 1)
 	if err != nil {
 		return 0, err
 	}
@@ -120,12 +289,11 @@ func (c *Client) ReadInt16(address uint16) (int16, error) {
 }
 
 func (c *Client) ReadUint32(address uint16) (uint32, error) {
-	regs, err := c.ReadInputRegisters(address, 2)
+	regs, err := c.readRegisters(address, 2)
 	if err != nil {
 		return 0, err
 	}
-	// Little-endian: low word first, high word second
-	return uint32(regs[0]) | uint32(regs[1])<<16, nil
+	return c.wordOrder.Uint32(regs), nil
 }
 
 func (c *Client) ReadInt32(address uint16) (int32, error) {
@@ -137,12 +305,15 @@ func (c *Client) ReadInt32(address uint16) (int32, error) {
 }
 
 func (c *Client) ReadString(address uint16, length uint16) (string, error) {
-	regs, err := c.ReadInputRegisters(address, length)
+	regs, err := c.readRegisters(address, length)
 	if err != nil {
 		return "", err
 	}
+	return decodeString(regs), nil
+}
 
-	bytes := make([]byte, 0, length*2)
+func decodeString(regs []uint16) string {
+	bytes := make([]byte, 0, len(regs)*2)
 	for _, reg := range regs {
 		bytes = append(bytes, byte(reg>>8), byte(reg&0xFF))
 	}
@@ -152,7 +323,7 @@ func (c *Client) ReadString(address uint16, length uint16) (string, error) {
 		bytes = bytes[:len(bytes)-1]
 	}
 
-	return string(bytes), nil
+	return string(bytes)
 }
 
 func (c *Client) Reconnect() error {
@@ -0,0 +1,246 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/simonvetter/modbus"
+)
+
+// fakeTransport serves input registers from a map and records the
+// requests it receives.
+type fakeTransport struct {
+	input map[uint16]uint16
+	reads []registerRange
+}
+
+func (f *fakeTransport) ReadRegisters(address, quantity uint16, regType modbus.RegType) ([]uint16, error) {
+	if regType != modbus.INPUT_REGISTER {
+		return nil, modbus.ErrIllegalFunction
+	}
+	f.reads = append(f.reads, registerRange{start: address, count: quantity})
+	regs := make([]uint16, quantity)
+	for i := range regs {
+		value, ok := f.input[address+uint16(i)]
+		if !ok {
+			return nil, fmt.Errorf("register %d: %w", address+uint16(i), modbus.ErrIllegalDataAddress)
+		}
+		regs[i] = value
+	}
+	return regs, nil
+}
+
+func (f *fakeTransport) WriteRegister(address, value uint16) error {
+	return modbus.ErrIllegalFunction
+}
+
+func (f *fakeTransport) Close() error { return nil }
+
+func newTestClient(order WordOrder, input map[uint16]uint16) *Client {
+	return newTestClientWithConfig(ClientConfig{WordOrder: order}, input)
+}
+
+func newTestClientWithConfig(cfg ClientConfig, input map[uint16]uint16) *Client {
+	c := NewClient(cfg)
+	c.client = &fakeTransport{input: input}
+	return c
+}
+
+func TestReadUint32WordOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		order WordOrder
+		regs  [2]uint16
+		want  uint32
+	}{
+		{"low-high", WordOrderLowHigh, [2]uint16{0x5678, 0x1234}, 0x12345678},
+		{"high-low", WordOrderHighLow, [2]uint16{0x1234, 0x5678}, 0x12345678},
+		{"default is low-high", "", [2]uint16{0x0001, 0x0000}, 1},
+		{"high word only", WordOrderLowHigh, [2]uint16{0x0000, 0x0001}, 0x10000},
+		{"bytes within a word keep their order", WordOrderLowHigh, [2]uint16{0x00FF, 0xFF00}, 0xFF0000FF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(tt.order, map[uint16]uint16{5032: tt.regs[0], 5033: tt.regs[1]})
+			got, err := c.ReadUint32(5032)
+			if err != nil {
+				t.Fatalf("ReadUint32: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ReadUint32 = %#08x, want %#08x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadInt32Sign(t *testing.T) {
+	tests := []struct {
+		name  string
+		order WordOrder
+		regs  [2]uint16
+		want  int32
+	}{
+		// -1500 var is 0xFFFFFA24
+		{"negative reactive power low-high", WordOrderLowHigh, [2]uint16{0xFA24, 0xFFFF}, -1500},
+		{"negative reactive power high-low", WordOrderHighLow, [2]uint16{0xFFFF, 0xFA24}, -1500},
+		{"positive reactive power", WordOrderLowHigh, [2]uint16{0x05DC, 0x0000}, 1500},
+		{"minus one", WordOrderLowHigh, [2]uint16{0xFFFF, 0xFFFF}, -1},
+		{"minimum", WordOrderLowHigh, [2]uint16{0x0000, 0x8000}, -2147483648},
+		{"maximum", WordOrderLowHigh, [2]uint16{0xFFFF, 0x7FFF}, 2147483647},
+		// A negative low word alone does not make the value negative
+		{"low word sign bit", WordOrderLowHigh, [2]uint16{0x8000, 0x0000}, 32768},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(tt.order, map[uint16]uint16{5032: tt.regs[0], 5033: tt.regs[1]})
+			got, err := c.ReadInt32(5032)
+			if err != nil {
+				t.Fatalf("ReadInt32: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ReadInt32 = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadUint32FromSnapshotMatchesClient(t *testing.T) {
+	input := map[uint16]uint16{5030: 0, 5031: 0, 5032: 0xFA24, 5033: 0xFFFF}
+	for _, order := range []WordOrder{WordOrderLowHigh, WordOrderHighLow} {
+		c := newTestClient(order, input)
+		direct, err := c.ReadInt32(5032)
+		if err != nil {
+			t.Fatalf("%s: ReadInt32: %v", order, err)
+		}
+		block, err := c.ReadSnapshot(5030, 4)
+		if err != nil {
+			t.Fatalf("%s: ReadSnapshot: %v", order, err)
+		}
+		cached, err := block.ReadInt32(5032)
+		if err != nil {
+			t.Fatalf("%s: Block.ReadInt32: %v", order, err)
+		}
+		if cached != direct {
+			t.Errorf("%s: Block.ReadInt32 = %d, Client.ReadInt32 = %d", order, cached, direct)
+		}
+	}
+}
+
+func TestReadUint32Errors(t *testing.T) {
+	c := newTestClient(WordOrderLowHigh, map[uint16]uint16{5032: 1})
+	if _, err := c.ReadUint32(5032); err == nil {
+		t.Fatal("ReadUint32 with the high word missing succeeded")
+	}
+
+	c = NewClient(ClientConfig{})
+	if _, err := c.ReadInt32(5032); err == nil {
+		t.Fatal("ReadInt32 without a connection succeeded")
+	}
+}
+
+func TestReadRegistersMarksUnsupportedAfterConsecutiveExceptions(t *testing.T) {
+	c := newTestClient(WordOrderLowHigh, map[uint16]uint16{5011: 42})
+
+	for i := 1; i < ExceptionsBeforeUnsupported; i++ {
+		if _, err := c.ReadUint16(5012); errors.Is(err, ErrUnsupported) || !IsException(err) {
+			t.Fatalf("read %d: err = %v, want the exception", i, err)
+		}
+	}
+	if got := c.UnsupportedRegisters(); len(got) != 0 {
+		t.Fatalf("UnsupportedRegisters = %v after %d exceptions", got, ExceptionsBeforeUnsupported-1)
+	}
+
+	c.ReadUint16(5012)
+	if _, err := c.ReadUint16(5012); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("err = %v, want ErrUnsupported", err)
+	}
+	if got := c.UnsupportedRegisters(); len(got) != 1 || got[0] != 5012 {
+		t.Errorf("UnsupportedRegisters = %v, want [5012]", got)
+	}
+	if _, err := c.ReadUint16(5011); err != nil {
+		t.Errorf("supported register: %v", err)
+	}
+}
+
+func TestReadRegistersSuccessResetsExceptionCount(t *testing.T) {
+	input := map[uint16]uint16{}
+	c := newTestClient(WordOrderLowHigh, input)
+
+	for i := 0; i < 2*ExceptionsBeforeUnsupported; i++ {
+		if i%(ExceptionsBeforeUnsupported-1) == 0 {
+			input[5012] = 1
+		} else {
+			delete(input, 5012)
+		}
+		c.ReadUint16(5012)
+	}
+	if got := c.UnsupportedRegisters(); len(got) != 0 {
+		t.Errorf("UnsupportedRegisters = %v, want none", got)
+	}
+}
+
+func TestAlwaysReadIsNeverMarkedUnsupported(t *testing.T) {
+	c := newTestClient(WordOrderLowHigh, nil)
+	c.AlwaysRead(4989)
+
+	for i := 0; i < 2*ExceptionsBeforeUnsupported; i++ {
+		if _, err := c.ReadString(4989, 10); errors.Is(err, ErrUnsupported) {
+			t.Fatalf("read %d skipped the register", i)
+		}
+	}
+	if got := c.UnsupportedRegisters(); len(got) != 0 {
+		t.Errorf("UnsupportedRegisters = %v, want none", got)
+	}
+}
+
+func TestSplitRange(t *testing.T) {
+	tests := []struct {
+		name              string
+		start, count, max uint16
+		want              []registerRange
+	}{
+		{"empty", 5000, 0, 64, nil},
+		{"fits in one request", 5000, 64, 64, []registerRange{{5000, 64}}},
+		{"one register over", 5000, 65, 64, []registerRange{{5000, 64}, {5064, 1}}},
+		{"several requests", 5000, 100, 30, []registerRange{{5000, 30}, {5030, 30}, {5060, 30}, {5090, 10}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitRange(tt.start, tt.count, tt.max)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("splitRange(%d, %d, %d) = %v, want %v", tt.start, tt.count, tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBlockSplitsAndConcatenatesInOrder(t *testing.T) {
+	input := make(map[uint16]uint16)
+	for i := uint16(0); i < 100; i++ {
+		input[5000+i] = i
+	}
+	c := newTestClientWithConfig(ClientConfig{MaxRegistersPerRead: 40}, input)
+
+	regs, err := c.ReadBlock(5000, 100)
+	if err != nil {
+		t.Fatalf("ReadBlock: %v", err)
+	}
+
+	reads := c.client.(*fakeTransport).reads
+	want := []registerRange{{5000, 40}, {5040, 40}, {5080, 20}}
+	if fmt.Sprint(reads) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", reads, want)
+	}
+	if len(regs) != 100 {
+		t.Fatalf("got %d registers, want 100", len(regs))
+	}
+	for i, value := range regs {
+		if value != uint16(i) {
+			t.Fatalf("register %d = %d, want %d", i, value, i)
+		}
+	}
+}
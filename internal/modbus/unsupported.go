@@ -0,0 +1,101 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/simonvetter/modbus"
+)
+
+// ErrUnsupported is returned, without a request going out, for registers
+// the inverter already refused with a Modbus exception.
+var ErrUnsupported = errors.New("register not supported by the inverter")
+
+// IsException reports whether err is the inverter refusing a request,
+// e.g. for a register its model does not have, as opposed to a transport
+// error that may well go away on the next try.
+func IsException(err error) bool {
+	return errors.Is(err, modbus.ErrIllegalFunction) ||
+		errors.Is(err, modbus.ErrIllegalDataAddress) ||
+		errors.Is(err, modbus.ErrIllegalDataValue)
+}
+
+// ExceptionsBeforeUnsupported is how many exceptions in a row mark a
+// register unsupported. A WiNet dongle occasionally answers a valid
+// request with an exception, which a single retry cycle should not turn
+// into a permanent gap.
+const ExceptionsBeforeUnsupported = 3
+
+// readRegisters is ReadInputRegisters for the single-value reads. After
+// ExceptionsBeforeUnsupported exceptions in a row, address is marked
+// unsupported and later reads of it fail with ErrUnsupported at once,
+// until the next Connect. Addresses passed to AlwaysRead are never marked.
+func (c *Client) readRegisters(address, quantity uint16) ([]uint16, error) {
+	c.mu.Lock()
+	skip := c.unsupported[address]
+	c.mu.Unlock()
+	if skip {
+		return nil, fmt.Errorf("input register %d: %w", address, ErrUnsupported)
+	}
+
+	regs, err := c.ReadInputRegisters(address, quantity)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil || !IsException(err) || c.alwaysRead[address] {
+		delete(c.exceptions, address)
+		return regs, err
+	}
+	if c.exceptions == nil {
+		c.exceptions = make(map[uint16]int)
+	}
+	c.exceptions[address]++
+	if c.exceptions[address] < ExceptionsBeforeUnsupported {
+		return regs, err
+	}
+	if c.unsupported == nil {
+		c.unsupported = make(map[uint16]bool)
+	}
+	c.unsupported[address] = true
+	slog.Info("Register not supported by the inverter, no longer reading it", "address", address, "err", err)
+	return regs, err
+}
+
+// AlwaysRead exempts addresses from being marked unsupported, for
+// registers every model has, such as the serial number whose read decides
+// whether the inverter is online.
+func (c *Client) AlwaysRead(addresses ...uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.alwaysRead == nil {
+		c.alwaysRead = make(map[uint16]bool)
+	}
+	for _, address := range addresses {
+		c.alwaysRead[address] = true
+	}
+}
+
+// Connections returns how many connections Connect has opened, so callers
+// can reset state tied to a connection.
+func (c *Client) Connections() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connections
+}
+
+// UnsupportedRegisters returns the addresses marked unsupported so far, in
+// ascending order.
+func (c *Client) UnsupportedRegisters() []uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	addresses := make([]uint16, 0, len(c.unsupported))
+	for address := range c.unsupported {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+	return addresses
+}
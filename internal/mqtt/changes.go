@@ -0,0 +1,66 @@
+package mqtt
+
+import "math"
+
+// defaultChangeThresholds is the smallest change of each per-value topic
+// that is worth publishing when only changes are sent. Topics missing here
+// are published on any change.
+var defaultChangeThresholds = map[string]float64{
+	"power":          1,
+	"dc_power":       1,
+	"energy_daily":   0.1,
+	"energy_total":   0.1,
+	"temperature":    0.1,
+	"mppt1_voltage":  0.1,
+	"mppt2_voltage":  0.1,
+	"grid_voltage":   0.1,
+	"mppt1_current":  0.01,
+	"mppt2_current":  0.01,
+	"mppt1_power":    1,
+	"mppt2_power":    1,
+	"grid_current":   0.1,
+	"grid_frequency": 0.01,
+	"power_factor":   0.001,
+	"reactive_power": 1,
+	"utilization":    0.1,
+}
+
+// changeThresholds merges the configured thresholds over the defaults.
+func changeThresholds(configured map[string]float64) map[string]float64 {
+	thresholds := make(map[string]float64, len(defaultChangeThresholds)+len(configured))
+	for name, threshold := range defaultChangeThresholds {
+		thresholds[name] = threshold
+	}
+	for name, threshold := range configured {
+		thresholds[name] = threshold
+	}
+	return thresholds
+}
+
+// changed reports whether value differs from the last published one by at
+// least threshold. Non-numeric values count as changed when not equal.
+func changed(last, value interface{}, threshold float64) bool {
+	a, aok := toFloat(last)
+	b, bok := toFloat(value)
+	if !aok || !bok {
+		return last != value
+	}
+	// The relative slack absorbs rounding such as 230.3-230.2 < 0.1
+	diff := math.Abs(b - a)
+	return diff > 0 && diff >= threshold*(1-1e-9)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case uint32:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
@@ -1,20 +1,54 @@
 package mqtt
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
+	"sync"
 	"time"
 
 	"sungrow-monitor/internal/inverter"
+	"sungrow-monitor/internal/storage"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// Status payload key styles
+const (
+	StatusFormatStruct = "struct"
+	StatusFormatTopics = "topics"
+)
+
 type Publisher struct {
-	client      mqtt.Client
-	topicPrefix string
-	enabled     bool
+	opts         *mqtt.ClientOptions
+	topicPrefix  string
+	model        string
+	inverterID   string
+	statusFormat string
+	enabled      bool
+
+	changesOnly bool
+	thresholds  map[string]float64
+
+	fullStatus bool
+	individual bool
+
+	availability bool
+
+	// connMu guards client and serial: without an inverter ID the topics
+	// follow the serial once it is known, and the client is replaced to
+	// move its Last Will along.
+	connMu sync.RWMutex
+	client mqtt.Client
+	serial string
+
+	mu               sync.Mutex
+	discovered       *inverter.Capabilities
+	discoveredSerial string
+	lastPublished    map[string]interface{}
+	available        bool
 }
 
 type PublisherConfig struct {
@@ -24,6 +58,40 @@ type PublisherConfig struct {
 	Password    string
 	TopicPrefix string
 	Enabled     bool
+
+	// Model names the device in topic paths and discovery; empty means
+	// inverter.DefaultModel.
+	Model string
+
+	// InverterID tells inverters sharing a broker apart: it replaces the
+	// model in topic paths and makes the Home Assistant device and entity
+	// IDs unique. Empty uses the inverter serial once it is known.
+	InverterID string
+
+	// Serial is the serial last read from the inverter, e.g. from the
+	// database, so the topics and the Last Will are right from the first
+	// connection. Empty waits for the first reading.
+	Serial string
+
+	// StatusFormat selects the keys of the JSON status payload:
+	// StatusFormatStruct (default) or StatusFormatTopics.
+	StatusFormat string
+
+	// ChangesOnly skips per-value topics whose value moved less than its
+	// threshold since it was last published. ChangeThresholds overrides
+	// the default threshold of individual topics.
+	ChangesOnly      bool
+	ChangeThresholds map[string]float64
+
+	// FullStatus publishes the JSON status topic and Individual the
+	// per-value topics; low-bandwidth setups can turn either off.
+	FullStatus bool
+	Individual bool
+
+	// Availability maintains the retained availability topic: a Last Will
+	// marks it offline when the connection drops, and it follows the
+	// inverter's state while connected. One-off clients leave it off.
+	Availability bool
 }
 
 func NewPublisher(cfg PublisherConfig) (*Publisher, error) {
@@ -31,35 +99,114 @@ func NewPublisher(cfg PublisherConfig) (*Publisher, error) {
 		return &Publisher{enabled: false}, nil
 	}
 
-	opts := mqtt.NewClientOptions().
+	model := cfg.Model
+	if model == "" {
+		model = inverter.DefaultModel
+	}
+
+	p := &Publisher{
+		topicPrefix:  cfg.TopicPrefix,
+		model:        model,
+		inverterID:   sanitizeID(cfg.InverterID),
+		statusFormat: cfg.StatusFormat,
+		enabled:      true,
+
+		changesOnly:   cfg.ChangesOnly,
+		thresholds:    changeThresholds(cfg.ChangeThresholds),
+		lastPublished: make(map[string]interface{}),
+
+		fullStatus: cfg.FullStatus,
+		individual: cfg.Individual,
+
+		availability: cfg.Availability,
+		available:    true,
+	}
+	if p.inverterID == "" {
+		p.serial = strings.TrimSpace(cfg.Serial)
+	}
+
+	p.opts = mqtt.NewClientOptions().
 		AddBroker(cfg.Broker).
 		SetClientID(cfg.ClientID).
 		SetAutoReconnect(true).
 		SetConnectRetry(true).
 		SetConnectRetryInterval(5 * time.Second).
 		SetConnectionLostHandler(func(c mqtt.Client, err error) {
-			log.Printf("MQTT connection lost: %v", err)
+			slog.Warn("MQTT connection lost", "err", err)
 		}).
 		SetOnConnectHandler(func(c mqtt.Client) {
-			log.Println("MQTT connected")
+			slog.Info("MQTT connected")
+			// The broker may hold the Last Will from a previous session
+			p.publishAvailability(c)
 		})
-
 	if cfg.Username != "" {
-		opts.SetUsername(cfg.Username)
-		opts.SetPassword(cfg.Password)
+		p.opts.SetUsername(cfg.Username)
+		p.opts.SetPassword(cfg.Password)
 	}
 
-	client := mqtt.NewClient(opts)
-	token := client.Connect()
+	p.client = p.newClient(p.serial)
+	token := p.client.Connect()
 	if token.Wait() && token.Error() != nil {
 		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
 	}
 
-	return &Publisher{
-		client:      client,
-		topicPrefix: cfg.TopicPrefix,
-		enabled:     true,
-	}, nil
+	return p, nil
+}
+
+// newClient creates a client whose Last Will marks the availability topic
+// of serial offline.
+func (p *Publisher) newClient(serial string) mqtt.Client {
+	if p.availability {
+		p.opts.SetWill(p.topicFor(serial, "availability"), availabilityOffline, 0, true)
+	}
+	return mqtt.NewClient(p.opts)
+}
+
+// mqttClient returns the current client.
+func (p *Publisher) mqttClient() mqtt.Client {
+	p.connMu.RLock()
+	defer p.connMu.RUnlock()
+	return p.client
+}
+
+// useSerial moves the topics to serial when they are keyed by it. The
+// retained availability and status of the previous namespace are cleared
+// and the client reconnects, since the Last Will is fixed per connection.
+func (p *Publisher) useSerial(serial string) {
+	serial = strings.TrimSpace(serial)
+	if p.inverterID != "" || serial == "" {
+		return
+	}
+
+	p.connMu.Lock()
+	if serial == p.serial {
+		p.connMu.Unlock()
+		return
+	}
+	previous := p.client
+	stale := []string{p.topicFor(p.serial, "availability"), p.topicFor(p.serial, "status")}
+	p.serial = serial
+	if p.availability {
+		p.client = p.newClient(serial)
+	}
+	p.connMu.Unlock()
+
+	slog.Info("MQTT topics now follow the inverter serial", "serial", serial)
+	for _, topic := range stale {
+		token := previous.Publish(topic, 0, true, "")
+		token.Wait()
+	}
+	if !p.availability {
+		return
+	}
+
+	// The old session must end cleanly first: a broker taking it over
+	// for the new client would publish its Last Will
+	previous.Disconnect(250)
+	token := p.mqttClient().Connect()
+	if token.Wait() && token.Error() != nil {
+		slog.Warn("Failed to reconnect to MQTT broker", "err", token.Error())
+	}
 }
 
 func (p *Publisher) Publish(data *inverter.InverterData) error {
@@ -67,8 +214,67 @@ func (p *Publisher) Publish(data *inverter.InverterData) error {
 		return nil
 	}
 
-	// Publish individual values
-	topics := map[string]interface{}{
+	// Keep the topics and the Home Assistant entities in line with the
+	// detected inverter
+	p.useSerial(data.SerialNumber)
+	p.ensureDiscovery(inverter.DetectCapabilities(data), data.SerialNumber)
+
+	if p.individual {
+		p.publishValues(data, p.changesOnly)
+	}
+	if !p.fullStatus {
+		return nil
+	}
+	return p.publishStatus(data, true)
+}
+
+// Availability payloads, the Home Assistant defaults
+const (
+	availabilityOnline  = "online"
+	availabilityOffline = "offline"
+)
+
+// SetInverterAvailable updates the availability topic when the inverter
+// stops or starts answering.
+func (p *Publisher) SetInverterAvailable(available bool) {
+	if !p.enabled || !p.availability {
+		return
+	}
+
+	p.mu.Lock()
+	changed := p.available != available
+	p.available = available
+	p.mu.Unlock()
+
+	if changed {
+		p.publishAvailability(p.mqttClient())
+	}
+}
+
+// publishAvailability publishes the current availability, retained.
+func (p *Publisher) publishAvailability(c mqtt.Client) {
+	if !p.availability {
+		return
+	}
+
+	p.mu.Lock()
+	payload := availabilityOffline
+	if p.available {
+		payload = availabilityOnline
+	}
+	p.mu.Unlock()
+
+	topic := p.topic("availability")
+	token := c.Publish(topic, 0, true, payload)
+	token.Wait()
+	if token.Error() != nil {
+		slog.Warn("Failed to publish", "topic", topic, "err", token.Error())
+	}
+}
+
+// valueTopics maps each per-value topic name to its value.
+func valueTopics(data *inverter.InverterData) map[string]interface{} {
+	return map[string]interface{}{
 		"power":           data.TotalActivePower,
 		"energy_daily":    data.DailyEnergy,
 		"energy_total":    data.TotalEnergy,
@@ -77,33 +283,104 @@ func (p *Publisher) Publish(data *inverter.InverterData) error {
 		"mppt1_current":   data.MPPT1Current,
 		"mppt2_voltage":   data.MPPT2Voltage,
 		"mppt2_current":   data.MPPT2Current,
+		"mppt1_power":     data.MPPT1Power,
+		"mppt2_power":     data.MPPT2Power,
 		"dc_power":        data.TotalDCPower,
 		"grid_voltage":    data.GridVoltage,
 		"grid_frequency":  data.GridFrequency,
 		"grid_current":    data.GridCurrent,
+		"reactive_power":  data.ReactivePower,
 		"power_factor":    data.PowerFactor,
+		"utilization":     data.UtilizationPercent,
 		"running_state":   data.RunningStateString,
 		"is_online":       data.IsOnline,
 	}
+}
+
+// topic returns the full topic for name under the device namespace.
+func (p *Publisher) topic(name string) string {
+	p.connMu.RLock()
+	serial := p.serial
+	p.connMu.RUnlock()
+	return p.topicFor(serial, name)
+}
+
+// topicFor returns the full topic for name when the topics follow serial.
+// The namespace is the inverter ID, else the serial, else the model.
+func (p *Publisher) topicFor(serial, name string) string {
+	namespace := p.model
+	switch {
+	case p.inverterID != "":
+		namespace = p.inverterID
+	case serial != "":
+		namespace = serial
+	}
+	return fmt.Sprintf("%s/%s/%s", p.topicPrefix, namespace, name)
+}
+
+// legacyNode is the discovery node ID used before entities were keyed by
+// the serial, when neither the inverter ID nor the serial is known.
+const legacyNode = "sungrow"
+
+// discoveryNode returns the Home Assistant discovery node ID, which also
+// prefixes the entity unique IDs, and the device identifier.
+func (p *Publisher) discoveryNode(serial string) (node, device string) {
+	switch {
+	case p.inverterID != "":
+		node = "sungrow_" + p.inverterID
+	case serial != "":
+		node = "sungrow_" + sanitizeID(serial)
+	default:
+		return legacyNode, "sungrow_sg5rs"
+	}
+	return node, node
+}
+
+// sanitizeID reduces id to the characters allowed in discovery node IDs.
+func sanitizeID(id string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(id)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// publishValues publishes the per-value topics. With changesOnly, values
+// that did not move by their threshold since last published are skipped.
+func (p *Publisher) publishValues(data *inverter.InverterData, changesOnly bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Publish individual values
+	for name, value := range valueTopics(data) {
+		if last, ok := p.lastPublished[name]; changesOnly && ok && !changed(last, value, p.thresholds[name]) {
+			continue
+		}
+		p.lastPublished[name] = value
 
-	for name, value := range topics {
-		topic := fmt.Sprintf("%s/%s/%s", p.topicPrefix, "SG5.0RS-S", name)
+		topic := p.topic(name)
 		payload := fmt.Sprintf("%v", value)
-		token := p.client.Publish(topic, 0, false, payload)
+		token := p.mqttClient().Publish(topic, 0, false, payload)
 		token.Wait()
 		if token.Error() != nil {
-			log.Printf("Failed to publish to %s: %v", topic, token.Error())
+			slog.Warn("Failed to publish", "topic", topic, "err", token.Error())
 		}
 	}
+}
 
+func (p *Publisher) publishStatus(data *inverter.InverterData, retained bool) error {
 	// Publish full status as JSON
-	statusJSON, err := json.Marshal(data)
+	statusJSON, err := p.marshalStatus(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal status: %w", err)
 	}
 
-	statusTopic := fmt.Sprintf("%s/%s/status", p.topicPrefix, "SG5.0RS-S")
-	token := p.client.Publish(statusTopic, 0, true, statusJSON)
+	statusTopic := p.topic("status")
+	token := p.mqttClient().Publish(statusTopic, 0, retained, statusJSON)
 	token.Wait()
 	if token.Error() != nil {
 		return fmt.Errorf("failed to publish status: %w", token.Error())
@@ -112,66 +389,296 @@ func (p *Publisher) Publish(data *inverter.InverterData) error {
 	return nil
 }
 
-func (p *Publisher) PublishHomeAssistantDiscovery() error {
+// marshalStatus encodes the status payload in the configured key style. The
+// topics style reuses the per-value topic names as keys, which is what most
+// Home Assistant templates expect, without touching the REST API shape.
+func (p *Publisher) marshalStatus(data *inverter.InverterData) ([]byte, error) {
+	if p.statusFormat != StatusFormatTopics {
+		return json.Marshal(data)
+	}
+
+	payload := valueTopics(data)
+	payload["timestamp"] = data.Timestamp
+	payload["serial_number"] = data.SerialNumber
+	return json.Marshal(payload)
+}
+
+// PublishDailySummary publishes a retained summary of a finished day, giving
+// Home Assistant one tidy record per day next to the live telemetry.
+func (p *Publisher) PublishDailySummary(stats *storage.DailyStats) error {
+	if !p.enabled {
+		return nil
+	}
+
+	summary := map[string]interface{}{
+		"date":            stats.Date.Format("2006-01-02"),
+		"energy_kwh":      stats.TotalEnergy,
+		"peak_power_w":    stats.MaxPower,
+		"peak_power_at":   stats.MaxPowerAt.Format(time.RFC3339),
+		"producing_hours": float64(stats.ProducingMinutes) / 60,
+		"readings_count":  stats.ReadingsCount,
+	}
+	payload, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal daily summary: %w", err)
+	}
+
+	topic := p.topic("daily_summary")
+	token := p.mqttClient().Publish(topic, 0, true, payload)
+	token.Wait()
+	if token.Error() != nil {
+		return fmt.Errorf("failed to publish daily summary: %w", token.Error())
+	}
+	return nil
+}
+
+// Republish sends historical readings, oldest first, on the regular value
+// and status topics, waiting delay between readings so the broker is not
+// flooded. The status is not retained so the live value survives the
+// backfill. It returns the number of readings sent.
+func (p *Publisher) Republish(ctx context.Context, history []*inverter.InverterData, delay time.Duration) (int, error) {
+	if !p.enabled {
+		return 0, fmt.Errorf("MQTT is disabled")
+	}
+
+	for i, data := range history {
+		if i > 0 && delay > 0 {
+			select {
+			case <-ctx.Done():
+				return i, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		if p.individual {
+			p.publishValues(data, false)
+		}
+		if p.fullStatus {
+			if err := p.publishStatus(data, false); err != nil {
+				return i, err
+			}
+		}
+	}
+	return len(history), nil
+}
+
+// discoverySensor describes a Home Assistant entity and which capabilities
+// it needs in order to be meaningful.
+type discoverySensor struct {
+	Name        string
+	ID          string
+	Unit        string
+	DeviceClass string
+	StateTopic  string
+	MinMPPT     int
+	ThreePhase  bool
+
+	// Component is the Home Assistant entity type; empty means "sensor".
+	// A "binary_sensor" reads the "true"/"false" payloads of bool topics.
+	Component string
+
+	// ValueTemplate extracts the value when StateTopic carries JSON.
+	ValueTemplate string
+}
+
+var discoverySensors = []discoverySensor{
+	{Name: "Power", ID: "power", Unit: "W", DeviceClass: "power", StateTopic: "power"},
+	{Name: "Daily Energy", ID: "energy_daily", Unit: "kWh", DeviceClass: "energy", StateTopic: "energy_daily"},
+	{Name: "Total Energy", ID: "energy_total", Unit: "kWh", DeviceClass: "energy", StateTopic: "energy_total"},
+	{Name: "Temperature", ID: "temperature", Unit: "°C", DeviceClass: "temperature", StateTopic: "temperature"},
+	{Name: "MPPT1 Voltage", ID: "mppt1_voltage", Unit: "V", DeviceClass: "voltage", StateTopic: "mppt1_voltage", MinMPPT: 1},
+	{Name: "MPPT1 Current", ID: "mppt1_current", Unit: "A", DeviceClass: "current", StateTopic: "mppt1_current", MinMPPT: 1},
+	{Name: "MPPT2 Voltage", ID: "mppt2_voltage", Unit: "V", DeviceClass: "voltage", StateTopic: "mppt2_voltage", MinMPPT: 2},
+	{Name: "MPPT2 Current", ID: "mppt2_current", Unit: "A", DeviceClass: "current", StateTopic: "mppt2_current", MinMPPT: 2},
+	{Name: "MPPT1 Power", ID: "mppt1_power", Unit: "W", DeviceClass: "power", StateTopic: "mppt1_power", MinMPPT: 1},
+	{Name: "MPPT2 Power", ID: "mppt2_power", Unit: "W", DeviceClass: "power", StateTopic: "mppt2_power", MinMPPT: 2},
+	{Name: "Grid Voltage", ID: "grid_voltage", Unit: "V", DeviceClass: "voltage", StateTopic: "grid_voltage"},
+	{Name: "Grid Frequency", ID: "grid_frequency", Unit: "Hz", DeviceClass: "frequency", StateTopic: "grid_frequency"},
+	{Name: "Grid Current", ID: "grid_current", Unit: "A", DeviceClass: "current", StateTopic: "grid_current"},
+	{Name: "Power Factor", ID: "power_factor", Unit: "", DeviceClass: "power_factor", StateTopic: "power_factor"},
+	{Name: "DC Power", ID: "dc_power", Unit: "W", DeviceClass: "power", StateTopic: "dc_power"},
+	{Name: "Reactive Power", ID: "reactive_power", Unit: "var", DeviceClass: "reactive_power", StateTopic: "reactive_power"},
+	{Name: "Utilization", ID: "utilization", Unit: "%", StateTopic: "utilization"},
+	{Name: "Running State", ID: "running_state", StateTopic: "running_state"},
+	{Name: "Online", ID: "is_online", DeviceClass: "connectivity", StateTopic: "is_online", Component: "binary_sensor"},
+	{Name: "Yesterday Energy", ID: "summary_energy", Unit: "kWh", DeviceClass: "energy", StateTopic: "daily_summary", ValueTemplate: "{{ value_json.energy_kwh }}"},
+	{Name: "Yesterday Peak Power", ID: "summary_peak_power", Unit: "W", DeviceClass: "power", StateTopic: "daily_summary", ValueTemplate: "{{ value_json.peak_power_w }}"},
+	{Name: "Yesterday Peak Power Time", ID: "summary_peak_power_at", DeviceClass: "timestamp", StateTopic: "daily_summary", ValueTemplate: "{{ value_json.peak_power_at }}"},
+	{Name: "Yesterday Producing Hours", ID: "summary_producing_hours", Unit: "h", DeviceClass: "duration", StateTopic: "daily_summary", ValueTemplate: "{{ value_json.producing_hours }}"},
+}
+
+// component returns the Home Assistant entity type of the sensor.
+func (s discoverySensor) component() string {
+	if s.Component == "" {
+		return "sensor"
+	}
+	return s.Component
+}
+
+// discoveryTopic returns the config topic of the sensor under node.
+func (s discoverySensor) discoveryTopic(node string) string {
+	return fmt.Sprintf("homeassistant/%s/%s/%s/config", s.component(), node, s.ID)
+}
+
+func (s discoverySensor) supportedBy(caps inverter.Capabilities) bool {
+	if s.MinMPPT > caps.MPPTCount {
+		return false
+	}
+	if s.ThreePhase && caps.Phases < 3 {
+		return false
+	}
+	return true
+}
+
+// ensureDiscovery republishes the discovery configs whenever the detected
+// capabilities or the serial number differ from the ones last announced. A
+// reading without a serial keeps the last one.
+func (p *Publisher) ensureDiscovery(caps inverter.Capabilities, serial string) {
+	p.mu.Lock()
+	current, currentSerial := p.discovered, p.discoveredSerial
+	p.mu.Unlock()
+
+	if serial == "" {
+		serial = currentSerial
+	}
+	if current != nil && *current == caps && serial == currentSerial {
+		return
+	}
+	if err := p.PublishHomeAssistantDiscovery(caps, serial); err != nil {
+		slog.Warn("Failed to publish Home Assistant discovery", "err", err)
+	}
+}
+
+// PublishHomeAssistantDiscovery announces the entities supported by caps and
+// publishes empty retained configs for the others so Home Assistant removes
+// entities left over from a previously detected model.
+func (p *Publisher) PublishHomeAssistantDiscovery(caps inverter.Capabilities, serial string) error {
 	if !p.enabled {
 		return nil
 	}
 
-	sensors := []struct {
-		Name       string
-		ID         string
-		Unit       string
-		DeviceClass string
-		StateTopic string
-	}{
-		{"Power", "power", "W", "power", "power"},
-		{"Daily Energy", "energy_daily", "kWh", "energy", "energy_daily"},
-		{"Total Energy", "energy_total", "kWh", "energy", "energy_total"},
-		{"Temperature", "temperature", "°C", "temperature", "temperature"},
-		{"MPPT1 Voltage", "mppt1_voltage", "V", "voltage", "mppt1_voltage"},
-		{"MPPT1 Current", "mppt1_current", "A", "current", "mppt1_current"},
-		{"Grid Voltage", "grid_voltage", "V", "voltage", "grid_voltage"},
-		{"Grid Frequency", "grid_frequency", "Hz", "frequency", "grid_frequency"},
-		{"Power Factor", "power_factor", "", "power_factor", "power_factor"},
+	for _, config := range p.discoveryConfigs(caps, serial) {
+		token := p.mqttClient().Publish(config.Topic, 0, true, config.Payload)
+		token.Wait()
+		if token.Error() != nil && len(config.Payload) > 0 {
+			return fmt.Errorf("failed to publish discovery for %s: %w", config.SensorID, token.Error())
+		}
 	}
 
-	for _, sensor := range sensors {
-		discoveryTopic := fmt.Sprintf("homeassistant/sensor/sungrow/%s/config", sensor.ID)
+	p.mu.Lock()
+	p.discovered = &caps
+	p.discoveredSerial = serial
+	p.mu.Unlock()
+
+	return nil
+}
+
+// discoveryConfig is a retained discovery message; an empty Payload
+// removes the entity.
+type discoveryConfig struct {
+	SensorID string
+	Topic    string
+	Payload  []byte
+}
+
+// discoveryConfigs builds the discovery message of every sensor, in the
+// order of discoverySensors. Without an inverter ID a known serial keys the
+// entities: the entities announced under the legacy node before the serial
+// was read are removed first, and the new ones keep their entity IDs so
+// Home Assistant carries their history over.
+func (p *Publisher) discoveryConfigs(caps inverter.Capabilities, serial string) []discoveryConfig {
+	node, deviceID := p.discoveryNode(serial)
+	migrate := p.inverterID == "" && serial != ""
+	deviceName := fmt.Sprintf("Sungrow %s", p.model)
+	if p.inverterID != "" {
+		deviceName = fmt.Sprintf("Sungrow %s (%s)", p.model, p.inverterID)
+	}
+	device := map[string]interface{}{
+		"identifiers":  []string{deviceID},
+		"name":         deviceName,
+		"manufacturer": "Sungrow",
+		"model":        caps.Model,
+	}
+	if serial != "" {
+		if serialID := "sungrow_" + sanitizeID(serial); serialID != deviceID {
+			device["identifiers"] = []string{deviceID, serialID}
+		}
+		device["serial_number"] = serial
+	}
+
+	configs := make([]discoveryConfig, 0, 2*len(discoverySensors))
+	if migrate {
+		for _, sensor := range discoverySensors {
+			configs = append(configs, discoveryConfig{SensorID: sensor.ID, Topic: sensor.discoveryTopic(legacyNode)})
+		}
+	}
+	for _, sensor := range discoverySensors {
+		discoveryTopic := sensor.discoveryTopic(node)
+
+		if !sensor.supportedBy(caps) {
+			configs = append(configs, discoveryConfig{SensorID: sensor.ID, Topic: discoveryTopic})
+			continue
+		}
 
 		config := map[string]interface{}{
 			"name":                fmt.Sprintf("Sungrow %s", sensor.Name),
-			"unique_id":           fmt.Sprintf("sungrow_%s", sensor.ID),
-			"state_topic":         fmt.Sprintf("%s/SG5.0RS-S/%s", p.topicPrefix, sensor.StateTopic),
+			"unique_id":           fmt.Sprintf("%s_%s", node, sensor.ID),
+			"state_topic":         p.topicFor(serial, sensor.StateTopic),
 			"unit_of_measurement": sensor.Unit,
-			"device": map[string]interface{}{
-				"identifiers":  []string{"sungrow_sg5rs"},
-				"name":         "Sungrow SG5.0RS-S",
-				"manufacturer": "Sungrow",
-				"model":        "SG5.0RS-S",
-			},
+			"device":              device,
 		}
 
 		if sensor.DeviceClass != "" {
 			config["device_class"] = sensor.DeviceClass
 		}
+		if sensor.ValueTemplate != "" {
+			config["value_template"] = sensor.ValueTemplate
+		}
+		if sensor.Unit == "" {
+			delete(config, "unit_of_measurement")
+		}
+		if migrate {
+			// The entity ID Home Assistant derived from the name
+			config["object_id"] = sanitizeID(fmt.Sprintf("Sungrow %s", sensor.Name))
+		}
+		if p.availability {
+			config["availability_topic"] = p.topicFor(serial, "availability")
+		}
+		if sensor.component() == "binary_sensor" {
+			config["payload_on"] = "true"
+			config["payload_off"] = "false"
+		}
 
 		payload, _ := json.Marshal(config)
-		token := p.client.Publish(discoveryTopic, 0, true, payload)
-		token.Wait()
+		configs = append(configs, discoveryConfig{SensorID: sensor.ID, Topic: discoveryTopic, Payload: payload})
 	}
+	return configs
+}
 
-	return nil
+// IsEnabled reports whether MQTT publishing is turned on in the config.
+func (p *Publisher) IsEnabled() bool {
+	return p.enabled
 }
 
 func (p *Publisher) IsConnected() bool {
 	if !p.enabled {
 		return false
 	}
-	return p.client.IsConnected()
+	return p.mqttClient().IsConnected()
 }
 
 func (p *Publisher) Close() {
-	if p.enabled && p.client != nil {
-		p.client.Disconnect(1000)
+	if !p.enabled {
+		return
+	}
+	client := p.mqttClient()
+	if client == nil {
+		return
+	}
+	// A clean disconnect does not trigger the Last Will
+	if p.availability && client.IsConnected() {
+		token := client.Publish(p.topic("availability"), 0, true, availabilityOffline)
+		token.Wait()
 	}
+	client.Disconnect(1000)
 }
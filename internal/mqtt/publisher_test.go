@@ -0,0 +1,241 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"sungrow-monitor/internal/inverter"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeClient records the messages published through it.
+type fakeClient struct {
+	mqtt.Client
+	published []fakeMessage
+}
+
+type fakeMessage struct {
+	topic    string
+	retained bool
+	payload  string
+}
+
+func (f *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	var body string
+	switch p := payload.(type) {
+	case string:
+		body = p
+	case []byte:
+		body = string(p)
+	default:
+		body = fmt.Sprint(p)
+	}
+	f.published = append(f.published, fakeMessage{topic: topic, retained: retained, payload: body})
+	return &mqtt.DummyToken{}
+}
+
+func (f *fakeClient) IsConnected() bool { return true }
+
+// newTestPublisher builds a publisher without a broker connection, for the
+// parts that only compute topics and payloads.
+func newTestPublisher(inverterID string) *Publisher {
+	return &Publisher{
+		topicPrefix:  "sungrow",
+		model:        inverter.DefaultModel,
+		inverterID:   sanitizeID(inverterID),
+		enabled:      true,
+		availability: true,
+	}
+}
+
+// discoveryPayload is the part of a discovery config the tests look at.
+type discoveryPayload struct {
+	UniqueID          string `json:"unique_id"`
+	ObjectID          string `json:"object_id"`
+	StateTopic        string `json:"state_topic"`
+	AvailabilityTopic string `json:"availability_topic"`
+	Device            struct {
+		Identifiers  []string `json:"identifiers"`
+		SerialNumber string   `json:"serial_number"`
+	} `json:"device"`
+}
+
+var twoMPPT = inverter.Capabilities{Model: "SG5K-D", MPPTCount: 2, Phases: 1}
+
+// discoveryIDs collects the discovery topics and the unique_id and topics
+// each announced entity refers to.
+func discoveryIDs(t *testing.T, p *Publisher, serial string) (topics, uniqueIDs map[string]bool) {
+	t.Helper()
+	topics = make(map[string]bool)
+	uniqueIDs = make(map[string]bool)
+	for _, config := range p.discoveryConfigs(twoMPPT, serial) {
+		topics[config.Topic] = true
+		if len(config.Payload) == 0 {
+			continue
+		}
+		var payload discoveryPayload
+		if err := json.Unmarshal(config.Payload, &payload); err != nil {
+			t.Fatalf("%s: %v", config.Topic, err)
+		}
+		if uniqueIDs[payload.UniqueID] {
+			t.Errorf("unique_id %s announced twice", payload.UniqueID)
+		}
+		uniqueIDs[payload.UniqueID] = true
+		// The daily summary sensors share one state topic
+		topics[payload.StateTopic] = true
+		topics[payload.AvailabilityTopic] = true
+	}
+	return topics, uniqueIDs
+}
+
+func TestDiscoveryOfNamedInvertersIsDisjoint(t *testing.T) {
+	roofTopics, roofIDs := discoveryIDs(t, newTestPublisher("Roof"), "")
+	garageTopics, garageIDs := discoveryIDs(t, newTestPublisher("garage"), "")
+
+	if len(roofIDs) == 0 || len(roofIDs) != len(garageIDs) {
+		t.Fatalf("announced %d and %d entities", len(roofIDs), len(garageIDs))
+	}
+	for id := range roofIDs {
+		if garageIDs[id] {
+			t.Errorf("unique_id %s is used by both inverters", id)
+		}
+	}
+	for topic := range roofTopics {
+		if garageTopics[topic] {
+			t.Errorf("topic %s is used by both inverters", topic)
+		}
+	}
+	if !roofTopics["sungrow/roof/power"] || !garageTopics["sungrow/garage/power"] {
+		t.Error("state topics are not namespaced by inverter name")
+	}
+}
+
+func TestDiscoveryRemovesUnsupportedSensors(t *testing.T) {
+	p := newTestPublisher("")
+	caps := inverter.Capabilities{Model: "SG3.0RS-S", MPPTCount: 1, Phases: 1}
+
+	for _, config := range p.discoveryConfigs(caps, "") {
+		removed := len(config.Payload) == 0
+		wantRemoved := config.SensorID == "mppt2_voltage" || config.SensorID == "mppt2_current" || config.SensorID == "mppt2_power"
+		if removed != wantRemoved {
+			t.Errorf("%s removed = %v, want %v", config.SensorID, removed, wantRemoved)
+		}
+	}
+}
+
+func TestDiscoveryOfUnnamedInvertersIsKeyedBySerial(t *testing.T) {
+	p := newTestPublisher("")
+	topicsA, idsA := discoveryIDs(t, p, "A2345")
+	_, idsB := discoveryIDs(t, p, "B6789")
+
+	for id := range idsA {
+		if idsB[id] {
+			t.Errorf("unique_id %s is used by both inverters", id)
+		}
+	}
+	if !idsA["sungrow_a2345_power"] || !topicsA["sungrow/A2345/power"] {
+		t.Errorf("unique IDs %v or topics %v do not follow the serial", idsA, topicsA)
+	}
+}
+
+func TestDiscoveryMigratesLegacyEntities(t *testing.T) {
+	p := newTestPublisher("")
+	configs := p.discoveryConfigs(twoMPPT, "A2345")
+
+	if len(configs) != 2*len(discoverySensors) {
+		t.Fatalf("got %d configs, want %d", len(configs), 2*len(discoverySensors))
+	}
+	// The legacy entities go first, so their entity IDs are free again
+	for i, sensor := range discoverySensors {
+		legacy := configs[i]
+		if want := sensor.discoveryTopic(legacyNode); legacy.Topic != want || len(legacy.Payload) != 0 {
+			t.Errorf("config %d = %s %q, want %s removed", i, legacy.Topic, legacy.Payload, want)
+		}
+	}
+
+	var power discoveryPayload
+	for _, config := range configs[len(discoverySensors):] {
+		if config.SensorID == "power" {
+			json.Unmarshal(config.Payload, &power)
+		}
+		if config.SensorID == "energy_daily" {
+			var energy discoveryPayload
+			json.Unmarshal(config.Payload, &energy)
+			if energy.ObjectID != "sungrow_daily_energy" {
+				t.Errorf("energy_daily object_id = %q, want the one derived from its name", energy.ObjectID)
+			}
+		}
+	}
+	if power.UniqueID != "sungrow_a2345_power" || power.ObjectID != "sungrow_power" {
+		t.Errorf("power unique_id %q, object_id %q", power.UniqueID, power.ObjectID)
+	}
+	if power.StateTopic != "sungrow/A2345/power" || power.AvailabilityTopic != "sungrow/A2345/availability" {
+		t.Errorf("power topics %q and %q do not follow the serial", power.StateTopic, power.AvailabilityTopic)
+	}
+	if len(power.Device.Identifiers) != 1 || power.Device.Identifiers[0] != "sungrow_a2345" || power.Device.SerialNumber != "A2345" {
+		t.Errorf("device = %+v", power.Device)
+	}
+}
+
+func TestDiscoveryOfNamedInverterKeepsItsIDs(t *testing.T) {
+	p := newTestPublisher("roof")
+	for _, config := range p.discoveryConfigs(twoMPPT, "A2345") {
+		if strings.Contains(config.Topic, "/"+legacyNode+"/") {
+			t.Errorf("named inverter removes %s", config.Topic)
+		}
+		var payload discoveryPayload
+		json.Unmarshal(config.Payload, &payload)
+		if payload.ObjectID != "" || payload.UniqueID != "sungrow_roof_"+config.SensorID {
+			t.Errorf("%s: unique_id %q, object_id %q", config.SensorID, payload.UniqueID, payload.ObjectID)
+		}
+		if payload.StateTopic != "" && !strings.HasPrefix(payload.StateTopic, "sungrow/roof/") {
+			t.Errorf("%s: state topic %s", config.SensorID, payload.StateTopic)
+		}
+	}
+}
+
+func TestPublishSwitchesTopicsOnceTheSerialIsKnown(t *testing.T) {
+	p := newTestPublisher("")
+	p.availability = false
+	p.individual = true
+	p.lastPublished = make(map[string]interface{})
+	client := &fakeClient{}
+	p.client = client
+
+	if got := p.topic("power"); got != "sungrow/"+inverter.DefaultModel+"/power" {
+		t.Fatalf("topic before the first reading = %s", got)
+	}
+
+	data := &inverter.InverterData{SerialNumber: "A2345", TotalActivePower: 1200, IsOnline: true}
+	if err := p.Publish(data); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	cleared := map[string]bool{}
+	for _, msg := range client.published {
+		if msg.retained && msg.payload == "" {
+			cleared[msg.topic] = true
+			continue
+		}
+		if !strings.HasPrefix(msg.topic, "sungrow/A2345/") && !strings.HasPrefix(msg.topic, "homeassistant/") {
+			t.Errorf("published on %s", msg.topic)
+		}
+	}
+	for _, topic := range []string{"sungrow/" + inverter.DefaultModel + "/status", "homeassistant/sensor/sungrow/power/config"} {
+		if !cleared[topic] {
+			t.Errorf("%s was not cleared", topic)
+		}
+	}
+
+	// Later readings stay on the serial topics without clearing again
+	client.published = nil
+	p.Publish(data)
+	for _, msg := range client.published {
+		if msg.retained && msg.payload == "" {
+			t.Errorf("%s cleared again", msg.topic)
+		}
+	}
+}
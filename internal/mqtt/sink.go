@@ -0,0 +1,104 @@
+package mqtt
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"sungrow-monitor/internal/events"
+	"sungrow-monitor/internal/storage"
+)
+
+// dailySummarySetting records the last day whose summary was published, so
+// a restart does not skip or repeat a summary.
+const dailySummarySetting = "mqtt.daily_summary.last_day"
+
+// Sink publishes the readings from the event bus and whether the inverter is
+// answering, plus the summary of the previous day once a new day starts.
+type Sink struct {
+	publisher          *Publisher
+	db                 *storage.Database
+	producingThreshold uint32
+	location           *time.Location
+	summaryDay         time.Time
+}
+
+type SinkConfig struct {
+	Publisher *Publisher
+	// Database backs the daily summary; nil disables it.
+	Database *storage.Database
+	// ProducingThreshold is passed to the daily stats behind the summary.
+	ProducingThreshold uint32
+	// Location decides when a new day starts; nil means time.Local.
+	Location *time.Location
+}
+
+func NewSink(cfg SinkConfig) *Sink {
+	location := cfg.Location
+	if location == nil {
+		location = time.Local
+	}
+	return &Sink{
+		publisher:          cfg.Publisher,
+		db:                 cfg.Database,
+		producingThreshold: cfg.ProducingThreshold,
+		location:           location,
+	}
+}
+
+// Run publishes the readings and availability changes on sub until ctx is
+// cancelled.
+func (s *Sink) Run(ctx context.Context, sub *events.Subscription) {
+	events.Consume(ctx, sub, func(event events.Event) {
+		switch e := event.(type) {
+		case events.ReadingEvent:
+			if err := s.publisher.Publish(e.Data); err != nil {
+				slog.Warn("Error publishing to MQTT", "err", err)
+			}
+			s.publishDailySummary(e.Data.Timestamp)
+		case events.StateChangeEvent:
+			// An asleep inverter still answers, so only offline counts
+			s.publisher.SetInverterAvailable(e.To != events.StateOffline)
+		}
+	})
+}
+
+// publishDailySummary publishes the summary of the previous day the first
+// time a reading from a new day arrives.
+func (s *Sink) publishDailySummary(now time.Time) {
+	if s.db == nil {
+		return
+	}
+
+	now = now.In(s.location)
+	yesterday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -1)
+	if s.summaryDay.IsZero() {
+		var last string
+		if found, err := s.db.GetSetting(dailySummarySetting, &last); err == nil && found {
+			if day, err := time.ParseInLocation("2006-01-02", last, now.Location()); err == nil {
+				s.summaryDay = day
+			}
+		}
+	}
+	if !s.summaryDay.Before(yesterday) {
+		return
+	}
+
+	stats, err := s.db.GetDailyStats(yesterday, s.producingThreshold)
+	if err != nil {
+		slog.Error("Error computing daily summary", "err", err)
+		return
+	}
+	if stats.ReadingsCount > 0 {
+		if err := s.publisher.PublishDailySummary(stats); err != nil {
+			slog.Warn("Error publishing daily summary", "err", err)
+			return
+		}
+		slog.Info("Published daily summary", "day", yesterday.Format("2006-01-02"), "energy_kwh", stats.TotalEnergy)
+	}
+
+	s.summaryDay = yesterday
+	if err := s.db.SetSetting(dailySummarySetting, yesterday.Format("2006-01-02")); err != nil {
+		slog.Error("Error saving daily summary state", "err", err)
+	}
+}
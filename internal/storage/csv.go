@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"strconv"
+	"time"
+)
+
+// CSVHeader names the columns written by InverterReading.CSVRecord.
+var CSVHeader = []string{
+	"timestamp", "serial_number", "device_type_code", "nominal_power_kw", "output_type",
+	"daily_energy_kwh", "total_energy_kwh", "lifetime_energy_kwh", "counter_reset", "temperature_c",
+	"mppt1_voltage_v", "mppt1_current_a", "mppt2_voltage_v", "mppt2_current_a",
+	"mppt1_power_w", "mppt2_power_w", "total_dc_power_w",
+	"grid_voltage_v", "grid_frequency_hz", "grid_current_a", "grid_direction",
+	"grid_phases", "line_voltage_v",
+	"phase_a_voltage_v", "phase_b_voltage_v", "phase_c_voltage_v",
+	"phase_a_current_a", "phase_b_current_a", "phase_c_current_a",
+	"total_active_power_w", "reactive_power_var", "apparent_power_va", "power_factor",
+	"efficiency_percent", "utilization_percent",
+	"running_state", "running_state_string", "fault_code", "is_online",
+}
+
+// CSVRecord formats the reading as a CSV row matching CSVHeader.
+func (r *InverterReading) CSVRecord() []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return []string{
+		r.Timestamp.Format(time.RFC3339),
+		r.SerialNumber,
+		strconv.FormatUint(uint64(r.DeviceTypeCode), 10),
+		f(r.NominalPower),
+		r.OutputType,
+		f(r.DailyEnergy),
+		f(r.TotalEnergy),
+		f(r.LifetimeEnergy),
+		strconv.FormatBool(r.CounterReset),
+		f(r.Temperature),
+		f(r.MPPT1Voltage),
+		f(r.MPPT1Current),
+		f(r.MPPT2Voltage),
+		f(r.MPPT2Current),
+		strconv.FormatUint(uint64(r.MPPT1Power), 10),
+		strconv.FormatUint(uint64(r.MPPT2Power), 10),
+		strconv.FormatUint(uint64(r.TotalDCPower), 10),
+		f(r.GridVoltage),
+		f(r.GridFrequency),
+		f(r.GridCurrent),
+		r.GridDirection,
+		strconv.Itoa(r.GridPhases),
+		f(r.LineVoltage),
+		f(r.PhaseAVoltage),
+		f(r.PhaseBVoltage),
+		f(r.PhaseCVoltage),
+		f(r.PhaseACurrent),
+		f(r.PhaseBCurrent),
+		f(r.PhaseCCurrent),
+		strconv.FormatUint(uint64(r.TotalActivePower), 10),
+		strconv.FormatInt(int64(r.ReactivePower), 10),
+		strconv.FormatUint(uint64(r.ApparentPower), 10),
+		f(r.PowerFactor),
+		f(r.EfficiencyPercent),
+		f(r.UtilizationPercent),
+		strconv.FormatUint(uint64(r.RunningState), 10),
+		r.RunningStateString,
+		strconv.FormatUint(uint64(r.FaultCode), 10),
+		strconv.FormatBool(r.IsOnline),
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVRecordMatchesHeader(t *testing.T) {
+	r := &InverterReading{
+		Timestamp:          time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		SerialNumber:       "A1",
+		LifetimeEnergy:     12345.6,
+		CounterReset:       true,
+		MPPT1Power:         1500,
+		MPPT2Power:         1400,
+		GridPhases:         3,
+		PhaseBCurrent:      4.2,
+		ApparentPower:      3000,
+		EfficiencyPercent:  96.5,
+		UtilizationPercent: 58.2,
+		IsOnline:           true,
+	}
+	record := r.CSVRecord()
+
+	if len(record) != len(CSVHeader) {
+		t.Fatalf("record has %d columns, header %d", len(record), len(CSVHeader))
+	}
+	columns := make(map[string]string, len(CSVHeader))
+	for i, name := range CSVHeader {
+		if _, dup := columns[name]; dup {
+			t.Errorf("column %s appears twice", name)
+		}
+		columns[name] = record[i]
+	}
+	want := map[string]string{
+		"timestamp":           "2024-06-01T12:00:00Z",
+		"lifetime_energy_kwh": "12345.6",
+		"counter_reset":       "true",
+		"mppt1_power_w":       "1500",
+		"mppt2_power_w":       "1400",
+		"grid_phases":         "3",
+		"phase_b_current_a":   "4.2",
+		"apparent_power_va":   "3000",
+		"efficiency_percent":  "96.5",
+		"utilization_percent": "58.2",
+		"is_online":           "true",
+	}
+	for name, value := range want {
+		if columns[name] != value {
+			t.Errorf("%s = %q, want %q", name, columns[name], value)
+		}
+	}
+}
+
+// TestCSVHeaderCoversStoredColumns catches a field added to InverterReading
+// without a CSV column.
+func TestCSVHeaderCoversStoredColumns(t *testing.T) {
+	inHeader := make(map[string]bool, len(CSVHeader))
+	for _, name := range CSVHeader {
+		inHeader[name] = true
+	}
+
+	readingType := reflect.TypeOf(InverterReading{})
+	for i := 0; i < readingType.NumField(); i++ {
+		field := readingType.Field(i)
+		if field.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !inHeader[name] {
+			t.Errorf("field %s (%q) has no CSV column", field.Name, name)
+		}
+	}
+}
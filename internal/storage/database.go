@@ -1,19 +1,40 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"sungrow-monitor/internal/inverter"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
+// producingMaxGap caps the time credited between two consecutive readings
+// so that an offline period is not counted as production.
+const producingMaxGap = 10 * time.Minute
+
+// sqliteParams turns on WAL, so API reads proceed while the collector
+// writes, and makes a connection wait up to 5s for a lock instead of failing
+// with "database is locked".
+const sqliteParams = "_journal_mode=WAL&_busy_timeout=5000"
+
+// maxOpenConns leaves room for concurrent readers; WAL still serializes
+// writers, which wait on the busy timeout.
+const maxOpenConns = 4
+
 type Database struct {
 	db *gorm.DB
+
+	// lifetime is shared by every Database derived with WithContext.
+	lifetime *lifetimeTracker
 }
 
 func NewDatabase(path string) (*Database, error) {
@@ -23,23 +44,146 @@ func NewDatabase(path string) (*Database, error) {
 		// Directory will be created by SQLite if it doesn't exist
 	}
 
-	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+	dsn := path + "?" + sqliteParams
+	if strings.Contains(path, "?") {
+		dsn = path + "&" + sqliteParams
+	}
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(maxOpenConns)
+
+	if err := dedupeReadings(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
 
 	// Auto-migrate the schema
-	if err := db.AutoMigrate(&InverterReading{}); err != nil {
+	if err := db.AutoMigrate(&InverterReading{}, &Setting{}, &FaultEvent{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	dropped, err := dropObsoleteIndexes(db)
+	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	return &Database{db: db}, nil
+	d := &Database{db: db, lifetime: &lifetimeTracker{}}
+	if dropped || !d.hasStatistics() {
+		if err := d.Analyze(); err != nil {
+			slog.Warn("Failed to analyze database", "err", err)
+		}
+	}
+	return d, nil
+}
+
+// obsoleteIndexes were made redundant by the unique index on (timestamp,
+// serial_number), which serves range queries too, yet every insert still
+// paid for them.
+var obsoleteIndexes = []string{"idx_inverter_readings_timestamp", "idx_readings_serial_timestamp"}
+
+// dropObsoleteIndexes removes obsoleteIndexes from databases created
+// before they went, and reports whether there were any.
+func dropObsoleteIndexes(db *gorm.DB) (bool, error) {
+	migrator := db.Migrator()
+	var dropped bool
+	for _, name := range obsoleteIndexes {
+		if !migrator.HasIndex(&InverterReading{}, name) {
+			continue
+		}
+		if err := migrator.DropIndex(&InverterReading{}, name); err != nil {
+			return dropped, err
+		}
+		dropped = true
+	}
+	return dropped, nil
+}
+
+// hasStatistics reports whether ANALYZE has recorded statistics for the
+// readings table.
+func (d *Database) hasStatistics() bool {
+	var count int64
+	err := d.db.Raw("SELECT COUNT(*) FROM sqlite_stat1 WHERE tbl = 'inverter_readings'").Scan(&count).Error
+	return err == nil && count > 0
+}
+
+// Analyze refreshes the statistics the query planner uses. Without them
+// SQLite picks the deleted_at index, which every live row shares, over the
+// timestamp one for range queries. It runs after migrations and after
+// retention cleanups; a sampled ANALYZE is quick even on a large table.
+func (d *Database) Analyze() error {
+	return d.db.Exec("PRAGMA analysis_limit=1000; ANALYZE").Error
+}
+
+// WithContext returns a Database whose queries are cancelled with ctx.
+func (d *Database) WithContext(ctx context.Context) *Database {
+	return &Database{db: d.db.WithContext(ctx), lifetime: d.lifetime}
+}
+
+// readingsUniqueIndex makes a reading unique per inverter and timestamp.
+const readingsUniqueIndex = "idx_readings_timestamp_serial"
+
+// upsertBatchSize keeps a multi-row upsert well under SQLite's limit on
+// bound variables.
+const upsertBatchSize = 100
+
+// dedupeReadings removes duplicate readings, keeping the newest row of each
+// timestamp and serial number, so the unique index can be created on a
+// database written before it existed.
+func dedupeReadings(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&InverterReading{}) || migrator.HasIndex(&InverterReading{}, readingsUniqueIndex) {
+		return nil
+	}
+
+	result := db.Exec(`DELETE FROM inverter_readings WHERE id NOT IN (
+		SELECT MAX(id) FROM inverter_readings GROUP BY timestamp, serial_number)`)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		slog.Info("Removed duplicate readings before adding the unique index", "count", result.RowsAffected)
+	}
+	return nil
 }
 
+// SaveReading stores data. A second reading with the same timestamp, e.g.
+// when timestamps are aligned to the interval, replaces the first.
 func (d *Database) SaveReading(data *inverter.InverterData) error {
-	reading := &InverterReading{
+	return d.UpsertReading(NewReading(data))
+}
+
+// UpsertReading stores reading, replacing the stored reading with the same
+// timestamp and serial number if there is one.
+func (d *Database) UpsertReading(reading *InverterReading) error {
+	return d.db.Clauses(upsertReadingClause()).Create(reading).Error
+}
+
+// UpsertReadings is the batch form of UpsertReading, so re-importing the
+// same readings is idempotent.
+func (d *Database) UpsertReadings(readings []InverterReading) error {
+	if len(readings) == 0 {
+		return nil
+	}
+	return d.db.Clauses(upsertReadingClause()).CreateInBatches(readings, upsertBatchSize).Error
+}
+
+func upsertReadingClause() clause.OnConflict {
+	return clause.OnConflict{
+		Columns:   []clause.Column{{Name: "timestamp"}, {Name: "serial_number"}},
+		UpdateAll: true,
+	}
+}
+
+// NewReading converts inverter data into its stored form.
+func NewReading(data *inverter.InverterData) *InverterReading {
+	return &InverterReading{
 		Timestamp:          data.Timestamp,
 		SerialNumber:       data.SerialNumber,
 		DeviceTypeCode:     data.DeviceTypeCode,
@@ -47,25 +191,39 @@ func (d *Database) SaveReading(data *inverter.InverterData) error {
 		OutputType:         data.OutputType,
 		DailyEnergy:        data.DailyEnergy,
 		TotalEnergy:        data.TotalEnergy,
+		LifetimeEnergy:     data.LifetimeEnergy,
+		CounterReset:       data.CounterReset,
 		Temperature:        data.Temperature,
 		MPPT1Voltage:       data.MPPT1Voltage,
 		MPPT1Current:       data.MPPT1Current,
 		MPPT2Voltage:       data.MPPT2Voltage,
 		MPPT2Current:       data.MPPT2Current,
+		MPPT1Power:         data.MPPT1Power,
+		MPPT2Power:         data.MPPT2Power,
 		TotalDCPower:       data.TotalDCPower,
 		GridVoltage:        data.GridVoltage,
 		GridFrequency:      data.GridFrequency,
 		GridCurrent:        data.GridCurrent,
+		GridDirection:      data.GridDirection,
+		GridPhases:         data.GridPhases,
+		LineVoltage:        data.LineVoltage,
+		PhaseAVoltage:      data.PhaseAVoltage,
+		PhaseBVoltage:      data.PhaseBVoltage,
+		PhaseCVoltage:      data.PhaseCVoltage,
+		PhaseACurrent:      data.PhaseACurrent,
+		PhaseBCurrent:      data.PhaseBCurrent,
+		PhaseCCurrent:      data.PhaseCCurrent,
 		TotalActivePower:   data.TotalActivePower,
 		ReactivePower:      data.ReactivePower,
+		ApparentPower:      data.ApparentPower,
+		EfficiencyPercent:  data.EfficiencyPercent,
+		UtilizationPercent: data.UtilizationPercent,
 		PowerFactor:        data.PowerFactor,
 		RunningState:       data.RunningState,
 		RunningStateString: data.RunningStateString,
 		FaultCode:          data.FaultCode,
 		IsOnline:           data.IsOnline,
 	}
-
-	return d.db.Create(reading).Error
 }
 
 func (d *Database) GetLatestReading() (*InverterReading, error) {
@@ -77,6 +235,32 @@ func (d *Database) GetLatestReading() (*InverterReading, error) {
 	return &reading, nil
 }
 
+// GetNearestReading returns the reading whose timestamp is closest to t,
+// comparing the last reading at or before t with the first one after it.
+func (d *Database) GetNearestReading(t time.Time) (*InverterReading, error) {
+	var before, after InverterReading
+	beforeErr := d.db.Where("timestamp <= ?", t).Order("timestamp desc").First(&before).Error
+	afterErr := d.db.Where("timestamp > ?", t).Order("timestamp asc").First(&after).Error
+
+	switch {
+	case beforeErr != nil && !errors.Is(beforeErr, gorm.ErrRecordNotFound):
+		return nil, beforeErr
+	case afterErr != nil && !errors.Is(afterErr, gorm.ErrRecordNotFound):
+		return nil, afterErr
+	case beforeErr != nil && afterErr != nil:
+		return nil, gorm.ErrRecordNotFound
+	case beforeErr != nil:
+		return &after, nil
+	case afterErr != nil:
+		return &before, nil
+	}
+
+	if t.Sub(before.Timestamp) <= after.Timestamp.Sub(t) {
+		return &before, nil
+	}
+	return &after, nil
+}
+
 func (d *Database) GetReadingsByRange(from, to time.Time) ([]InverterReading, error) {
 	var readings []InverterReading
 	result := d.db.Where("timestamp BETWEEN ? AND ?", from, to).
@@ -88,6 +272,63 @@ func (d *Database) GetReadingsByRange(from, to time.Time) ([]InverterReading, er
 	return readings, nil
 }
 
+// StreamReadingsByRange scans the readings in [from, to], newest first, one
+// row at a time through a database cursor so memory use does not grow with
+// the size of the range. Iteration stops at the first error from fn.
+func (d *Database) StreamReadingsByRange(from, to time.Time, fn func(*InverterReading) error) error {
+	rows, err := d.db.Model(&InverterReading{}).
+		Where("timestamp BETWEEN ? AND ?", from, to).
+		Order("timestamp desc").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reading InverterReading
+		if err := d.db.ScanRows(rows, &reading); err != nil {
+			return err
+		}
+		if err := fn(&reading); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ForEachReadingInRange walks the readings in [from, to] in timestamp
+// order, handing them to fn in batches so that large ranges can be
+// streamed without loading every row at once. Readings that share a
+// timestamp are ordered by id, which keeps the paging cursor stable even
+// when rows were not inserted chronologically.
+func (d *Database) ForEachReadingInRange(from, to time.Time, batchSize int, fn func([]InverterReading) error) error {
+	var last *InverterReading
+	for {
+		var batch []InverterReading
+		query := d.db.Where("timestamp BETWEEN ? AND ?", from, to)
+		if last != nil {
+			query = query.Where("timestamp > ? OR (timestamp = ? AND id > ?)", last.Timestamp, last.Timestamp, last.ID)
+		}
+		result := query.Order("timestamp asc, id asc").
+			Limit(batchSize).
+			Find(&batch)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		last = &batch[len(batch)-1]
+	}
+}
+
 func (d *Database) GetReadingsWithLimit(limit int) ([]InverterReading, error) {
 	var readings []InverterReading
 	result := d.db.Order("timestamp desc").Limit(limit).Find(&readings)
@@ -111,6 +352,53 @@ func (d *Database) GetDailyEnergy(date time.Time) (float64, error) {
 	return reading.DailyEnergy, nil
 }
 
+// GetHourlyEnergy splits the day's energy into 24 hourly buckets from the
+// increase of the daily energy counter between consecutive readings. A
+// counter that goes down was reset, and its new value is the energy since
+// the reset.
+func (d *Database) GetHourlyEnergy(date time.Time) ([]HourlyEnergy, error) {
+	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	endOfDay := startOfDay.AddDate(0, 0, 1)
+
+	var samples []struct {
+		Timestamp   time.Time
+		DailyEnergy float64
+	}
+	result := d.db.Model(&InverterReading{}).
+		Select("timestamp, daily_energy").
+		Where("timestamp >= ? AND timestamp < ?", startOfDay, endOfDay).
+		Order("timestamp asc").
+		Scan(&samples)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	hours := make([]HourlyEnergy, 24)
+	for i := range hours {
+		hours[i].Hour = startOfDay.Add(time.Duration(i) * time.Hour)
+	}
+
+	// The counter restarts at midnight, so the first reading's value is
+	// all produced today
+	previous := 0.0
+	for _, sample := range samples {
+		delta := sample.DailyEnergy - previous
+		if delta < 0 {
+			delta = sample.DailyEnergy
+		}
+		previous = sample.DailyEnergy
+
+		hour := int(sample.Timestamp.In(date.Location()).Sub(startOfDay) / time.Hour)
+		if hour < 0 || hour >= len(hours) {
+			continue
+		}
+		hours[hour].Energy += delta
+		hours[hour].ReadingsCount++
+	}
+
+	return hours, nil
+}
+
 func (d *Database) GetTotalEnergy() (float64, error) {
 	var reading InverterReading
 	result := d.db.Order("timestamp desc").First(&reading)
@@ -120,28 +408,38 @@ func (d *Database) GetTotalEnergy() (float64, error) {
 	return reading.TotalEnergy, nil
 }
 
-func (d *Database) GetDailyStats(date time.Time) (*DailyStats, error) {
+// GetLifetimeEnergy returns the lifetime total kept across counter resets,
+// see TrackLifetimeEnergy.
+func (d *Database) GetLifetimeEnergy() (float64, error) {
+	lifetime, _, err := d.TrackLifetimeEnergy(0)
+	return lifetime, err
+}
+
+func (d *Database) GetDailyStats(date time.Time, producingThreshold uint32) (*DailyStats, error) {
 	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
 	endOfDay := startOfDay.Add(24 * time.Hour)
 
 	var stats DailyStats
 	stats.Date = startOfDay
 
-	// Get max power
-	var reading InverterReading
+	// Get max power and when it happened
+	var peak InverterReading
 	result := d.db.Where("timestamp BETWEEN ? AND ?", startOfDay, endOfDay).
 		Order("total_active_power desc").
-		First(&reading)
+		First(&peak)
 	if result.Error == nil {
-		stats.MaxPower = reading.TotalActivePower
+		stats.MaxPower = peak.TotalActivePower
+		stats.MaxPowerAt = peak.Timestamp
 	}
 
-	// Get latest daily energy
+	// Get latest daily energy. A separate struct is needed: First adds the
+	// primary key of a populated struct to the query conditions.
+	var latest InverterReading
 	result = d.db.Where("timestamp BETWEEN ? AND ?", startOfDay, endOfDay).
 		Order("timestamp desc").
-		First(&reading)
+		First(&latest)
 	if result.Error == nil {
-		stats.TotalEnergy = reading.DailyEnergy
+		stats.TotalEnergy = latest.DailyEnergy
 	}
 
 	// Get average temperature
@@ -157,12 +455,277 @@ func (d *Database) GetDailyStats(date time.Time) (*DailyStats, error) {
 		Where("timestamp BETWEEN ? AND ?", startOfDay, endOfDay).
 		Count(&stats.ReadingsCount)
 
+	// Get time spent producing above the threshold
+	producing, err := d.getProducingDuration(startOfDay, endOfDay, producingThreshold)
+	if err == nil {
+		stats.ProducingMinutes = int(producing / time.Minute)
+	}
+
 	return &stats, nil
 }
 
-func (d *Database) CleanOldReadings(olderThan time.Duration) error {
+// GetStatsByRange computes RangeStats for [from, to). Days are split in
+// from's location, where the inverter's daily counter is assumed to reset.
+func (d *Database) GetStatsByRange(from, to time.Time, producingThreshold uint32) (*RangeStats, error) {
+	stats := &RangeStats{From: from, To: to}
+	inRange := d.db.Model(&InverterReading{}).Where("timestamp >= ? AND timestamp < ?", from, to)
+
+	var aggregate struct {
+		MinPower       uint32
+		AvgPower       float64
+		AvgTemperature float64
+		ReadingsCount  int64
+	}
+	result := inRange.Session(&gorm.Session{}).
+		Select("MIN(total_active_power) AS min_power, AVG(total_active_power) AS avg_power, " +
+			"AVG(temperature) AS avg_temperature, COUNT(*) AS readings_count").
+		Scan(&aggregate)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if aggregate.ReadingsCount == 0 {
+		return stats, nil
+	}
+	stats.MinPower = aggregate.MinPower
+	stats.AvgPower = aggregate.AvgPower
+	stats.AvgTemperature = aggregate.AvgTemperature
+	stats.ReadingsCount = aggregate.ReadingsCount
+
+	var peak InverterReading
+	result = d.db.Where("timestamp >= ? AND timestamp < ?", from, to).
+		Order("total_active_power desc").
+		First(&peak)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	stats.MaxPower = peak.TotalActivePower
+	stats.MaxPowerAt = peak.Timestamp
+
+	// Last minus first counter value of each day
+	var samples []struct {
+		Timestamp   time.Time
+		DailyEnergy float64
+	}
+	result = inRange.Session(&gorm.Session{}).
+		Select("timestamp, daily_energy").
+		Order("timestamp asc").
+		Scan(&samples)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	var day string
+	var first, last float64
+	for _, sample := range samples {
+		if key := sample.Timestamp.In(from.Location()).Format("2006-01-02"); key != day {
+			stats.Energy += last - first
+			day, first = key, sample.DailyEnergy
+		}
+		last = sample.DailyEnergy
+	}
+	stats.Energy += last - first
+
+	producing, err := d.getProducingDuration(from, to, producingThreshold)
+	if err == nil {
+		stats.ProducingMinutes = int(producing / time.Minute)
+	}
+
+	return stats, nil
+}
+
+// GetDownsampledReadings splits [from, to) into the given number of equal
+// buckets and returns the average and maximum power of each, walking the
+// readings once.
+func (d *Database) GetDownsampledReadings(from, to time.Time, buckets int) ([]PowerBucket, error) {
+	if buckets <= 0 || !from.Before(to) {
+		return []PowerBucket{}, nil
+	}
+
+	width := to.Sub(from) / time.Duration(buckets)
+	if width <= 0 {
+		width = 1
+	}
+	points := make([]PowerBucket, buckets)
+	sums := make([]float64, buckets)
+	for i := range points {
+		points[i].Start = from.Add(time.Duration(i) * width)
+	}
+
+	rows, err := d.db.Model(&InverterReading{}).
+		Select("timestamp, total_active_power").
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sample struct {
+			Timestamp        time.Time
+			TotalActivePower uint32
+		}
+		if err := d.db.ScanRows(rows, &sample); err != nil {
+			return nil, err
+		}
+		i := int(sample.Timestamp.Sub(from) / width)
+		if i < 0 {
+			continue
+		}
+		// The division remainder lands in the last bucket
+		if i >= buckets {
+			i = buckets - 1
+		}
+		sums[i] += float64(sample.TotalActivePower)
+		points[i].ReadingsCount++
+		if sample.TotalActivePower > points[i].MaxPower {
+			points[i].MaxPower = sample.TotalActivePower
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range points {
+		if points[i].ReadingsCount > 0 {
+			points[i].AvgPower = sums[i] / float64(points[i].ReadingsCount)
+		}
+	}
+	return points, nil
+}
+
+// getProducingDuration integrates the time between consecutive readings
+// whose power is at or above the threshold.
+func (d *Database) getProducingDuration(from, to time.Time, threshold uint32) (time.Duration, error) {
+	var samples []powerSample
+	result := d.db.Model(&InverterReading{}).
+		Select("id, timestamp, total_active_power").
+		Where("timestamp BETWEEN ? AND ?", from, to).
+		Order("id asc").
+		Scan(&samples)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	orderSamples(samples)
+
+	var total time.Duration
+	forEachInterval(samples, producingMaxGap, func(prev, _ powerSample, dt time.Duration) {
+		if prev.TotalActivePower >= threshold {
+			total += dt
+		}
+	})
+	return total, nil
+}
+
+// ErrInsufficientData is returned when too few samples back an average for
+// it to be meaningful.
+var ErrInsufficientData = errors.New("insufficient data")
+
+// GetAveragePowerForTimeOfDay averages the active power of the readings taken
+// during the same time-of-day bucket as t over the previous days. It also
+// returns the number of samples behind the average, and ErrInsufficientData
+// with that count when there are fewer than minSamples.
+func (d *Database) GetAveragePowerForTimeOfDay(t time.Time, days int, bucket time.Duration, minSamples int64) (float64, int64, error) {
+	if days <= 0 || bucket <= 0 {
+		return 0, 0, nil
+	}
+
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight).Truncate(bucket)
+
+	query := d.db.Model(&InverterReading{})
+	conditions := d.db
+	for i := 1; i <= days; i++ {
+		start := midnight.AddDate(0, 0, -i).Add(offset)
+		conditions = conditions.Or("timestamp >= ? AND timestamp < ?", start, start.Add(bucket))
+	}
+
+	var result struct {
+		Avg   float64
+		Count int64
+	}
+	err := query.Select("COALESCE(AVG(total_active_power), 0) AS avg, COUNT(*) AS count").
+		Where(conditions).
+		Scan(&result).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	if result.Count < minSamples {
+		return 0, result.Count, ErrInsufficientData
+	}
+	return result.Avg, result.Count, nil
+}
+
+// GetPowerProfile buckets the readings of the days before day by time of day
+// and returns the average power and sample count of each bucket, starting
+// at midnight in day's location. Buckets with fewer than minSamples readings
+// average to zero.
+func (d *Database) GetPowerProfile(day time.Time, days int, bucket time.Duration, minSamples int64) ([]float64, []int64, error) {
+	if days <= 0 || bucket <= 0 {
+		return nil, nil, nil
+	}
+
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	n := int(24 * time.Hour / bucket)
+	sums := make([]float64, n)
+	counts := make([]int64, n)
+
+	var samples []powerSample
+	result := d.db.Model(&InverterReading{}).
+		Select("timestamp, total_active_power").
+		Where("timestamp >= ? AND timestamp < ?", midnight.AddDate(0, 0, -days), midnight).
+		Scan(&samples)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+
+	for _, sample := range samples {
+		ts := sample.Timestamp.In(day.Location())
+		sinceMidnight := ts.Sub(time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, ts.Location()))
+		i := int(sinceMidnight / bucket)
+		if i < 0 || i >= n {
+			continue
+		}
+		sums[i] += float64(sample.TotalActivePower)
+		counts[i]++
+	}
+
+	avgs := make([]float64, n)
+	for i := range sums {
+		if counts[i] > 0 && counts[i] >= minSamples {
+			avgs[i] = sums[i] / float64(counts[i])
+		}
+	}
+	return avgs, counts, nil
+}
+
+// CleanOldReadings deletes readings older than olderThan and returns how many
+// rows were removed.
+func (d *Database) CleanOldReadings(olderThan time.Duration) (int64, error) {
 	cutoff := time.Now().Add(-olderThan)
-	return d.db.Where("timestamp < ?", cutoff).Delete(&InverterReading{}).Error
+	result := d.db.Unscoped().Where("timestamp < ?", cutoff).Delete(&InverterReading{})
+	return result.RowsAffected, result.Error
+}
+
+// Vacuum rebuilds the SQLite file so space freed by deletes is returned to
+// the filesystem.
+func (d *Database) Vacuum() error {
+	return d.db.Exec("VACUUM").Error
+}
+
+// Ping checks that the underlying database connection is usable.
+func (d *Database) Ping() error {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Ping()
+}
+
+// CountReadings returns the number of stored readings.
+func (d *Database) CountReadings() (int64, error) {
+	var count int64
+	err := d.db.Model(&InverterReading{}).Count(&count).Error
+	return count, err
 }
 
 func (d *Database) Close() error {
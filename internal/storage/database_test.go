@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sungrow-monitor/internal/inverter"
+
+	"gorm.io/gorm"
+)
+
+// newTestDatabase opens a database in a temporary directory. A file is
+// used rather than :memory: because every pooled connection would get its
+// own in-memory database.
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	d, err := NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := d.db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return d
+}
+
+// saveReadings stores one reading of serial per timestamp.
+func saveReadings(t *testing.T, d *Database, serial string, timestamps ...time.Time) {
+	t.Helper()
+	for _, ts := range timestamps {
+		data := &inverter.InverterData{Timestamp: ts, SerialNumber: serial, IsOnline: true}
+		if err := d.SaveReading(data); err != nil {
+			t.Fatalf("SaveReading: %v", err)
+		}
+	}
+}
+
+func TestGetReadingsByRangeUsesTimestampIndex(t *testing.T) {
+	d := newTestDatabase(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, serial := range []string{"A1", "B2"} {
+		timestamps := make([]time.Time, 500)
+		for i := range timestamps {
+			timestamps[i] = start.Add(time.Duration(i) * time.Minute)
+		}
+		saveReadings(t, d, serial, timestamps...)
+	}
+	// Statistics are normally refreshed by the retention job
+	if err := d.Analyze(); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+
+	var query string
+	var vars []interface{}
+	err := d.db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		query = tx.Statement.SQL.String()
+		vars = tx.Statement.Vars
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	readings, err := d.GetReadingsByRange(start.Add(time.Hour), start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("GetReadingsByRange: %v", err)
+	}
+	if len(readings) != 122 {
+		t.Errorf("got %d readings, want 122", len(readings))
+	}
+
+	var plan []struct {
+		Detail string
+	}
+	if err := d.db.Raw("EXPLAIN QUERY PLAN "+query, vars...).Scan(&plan).Error; err != nil {
+		t.Fatalf("EXPLAIN QUERY PLAN: %v", err)
+	}
+	var details []string
+	for _, step := range plan {
+		details = append(details, step.Detail)
+	}
+	joined := strings.Join(details, "; ")
+	if !strings.Contains(joined, "USING INDEX "+readingsUniqueIndex) {
+		t.Errorf("plan does not use %s: %s", readingsUniqueIndex, joined)
+	}
+	if strings.Contains(joined, "TEMP B-TREE") {
+		t.Errorf("plan sorts in a temporary B-tree: %s", joined)
+	}
+}
+
+func TestObsoleteIndexesAreDropped(t *testing.T) {
+	d := newTestDatabase(t)
+	migrator := d.db.Migrator()
+	for _, name := range obsoleteIndexes {
+		if migrator.HasIndex(&InverterReading{}, name) {
+			t.Errorf("index %s exists", name)
+		}
+	}
+	if !migrator.HasIndex(&InverterReading{}, readingsUniqueIndex) {
+		t.Errorf("index %s is missing", readingsUniqueIndex)
+	}
+}
+
+func TestStreamReadingsStopsWhenContextIsCancelled(t *testing.T) {
+	d := newTestDatabase(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timestamps := make([]time.Time, 50)
+	for i := range timestamps {
+		timestamps[i] = start.Add(time.Duration(i) * time.Minute)
+	}
+	saveReadings(t, d, "A1", timestamps...)
+
+	// The client goes away after the first row
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rows := 0
+	err := d.WithContext(ctx).StreamReadingsByRange(start, start.Add(time.Hour), func(*InverterReading) error {
+		rows++
+		cancel()
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if rows >= len(timestamps) {
+		t.Errorf("scanned all %d rows after the cancellation", rows)
+	}
+}
+
+func TestForEachReadingInRangeFollowsTimestampOrder(t *testing.T) {
+	d := newTestDatabase(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	// Inserted out of order, as a backfill or clock correction would,
+	// with a second inverter sharing a timestamp across a batch boundary
+	saveReadings(t, d, "SN1", at(4), at(1), at(3), at(0), at(2), at(9))
+	saveReadings(t, d, "SN2", at(1))
+
+	var got []time.Time
+	err := d.ForEachReadingInRange(at(0), at(4), 2, func(batch []InverterReading) error {
+		for _, r := range batch {
+			got = append(got, r.Timestamp)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachReadingInRange: %v", err)
+	}
+
+	want := []time.Time{at(0), at(1), at(1), at(2), at(3), at(4)}
+	if len(got) != len(want) {
+		t.Fatalf("got %d readings %v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("reading %d at %s, want %s", i, got[i], want[i])
+		}
+	}
+}
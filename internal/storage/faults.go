@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"sungrow-monitor/internal/inverter"
+
+	"gorm.io/gorm"
+)
+
+// TrackFault opens a fault event when data carries a fault code and none is
+// open, and clears the open event once the code returns to zero or changes
+// to another fault. Readings of an offline inverter say nothing about
+// faults and are ignored.
+func (d *Database) TrackFault(data *inverter.InverterData) error {
+	if !data.IsOnline {
+		return nil
+	}
+
+	var open FaultEvent
+	result := d.db.Where("cleared_at IS NULL").Order("timestamp desc").First(&open)
+	hasOpen := result.Error == nil
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return result.Error
+	}
+
+	if hasOpen && open.FaultCode == data.FaultCode {
+		return nil
+	}
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if hasOpen {
+			clearedAt := data.Timestamp
+			if err := tx.Model(&open).Update("cleared_at", &clearedAt).Error; err != nil {
+				return err
+			}
+			slog.Info("Inverter fault cleared", "code", open.FaultCode, "fault", open.FaultString,
+				"lasted", clearedAt.Sub(open.Timestamp).Round(time.Second))
+		}
+		if data.FaultCode == 0 {
+			return nil
+		}
+
+		event := FaultEvent{
+			Timestamp:    data.Timestamp,
+			SerialNumber: data.SerialNumber,
+			FaultCode:    data.FaultCode,
+			FaultString:  inverter.GetFaultString(data.FaultCode),
+		}
+		slog.Warn("Inverter fault", "code", event.FaultCode, "fault", event.FaultString)
+		return tx.Create(&event).Error
+	})
+}
+
+// GetFaultEvents returns the fault events active at any point in
+// [from, to), oldest first.
+func (d *Database) GetFaultEvents(from, to time.Time) ([]FaultEvent, error) {
+	events := []FaultEvent{}
+	result := d.db.
+		Where("timestamp < ? AND (cleared_at IS NULL OR cleared_at >= ?)", to, from).
+		Order("timestamp asc").
+		Find(&events)
+	return events, result.Error
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// powerSample is the projection of a reading used by the time integration
+// helpers.
+type powerSample struct {
+	ID               uint
+	Timestamp        time.Time
+	TotalActivePower uint32
+}
+
+// orderSamples sorts samples, given in insertion order, by timestamp. When
+// the server clock steps backwards (e.g. an NTP correction) later rows carry
+// earlier timestamps; those are reported so the anomaly is visible.
+func orderSamples(samples []powerSample) {
+	outOfOrder := 0
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Timestamp.Before(samples[i-1].Timestamp) {
+			outOfOrder++
+		}
+	}
+	if outOfOrder == 0 {
+		return
+	}
+
+	slog.Warn("Found readings with timestamps earlier than the reading stored before them (clock jump?)", "count", outOfOrder)
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Timestamp.Before(samples[j].Timestamp)
+	})
+}
+
+// forEachInterval calls fn for each pair of consecutive samples with the
+// time between them clamped to [0, maxGap]. Samples must be ordered;
+// duplicate timestamps produce no interval.
+func forEachInterval(samples []powerSample, maxGap time.Duration, fn func(prev, cur powerSample, dt time.Duration)) {
+	for i := 1; i < len(samples); i++ {
+		dt := samples[i].Timestamp.Sub(samples[i-1].Timestamp)
+		if dt <= 0 {
+			continue
+		}
+		if dt > maxGap {
+			dt = maxGap
+		}
+		fn(samples[i-1], samples[i], dt)
+	}
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"sungrow-monitor/internal/inverter"
+)
+
+func TestOrderSamplesSortsStably(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	samples := []powerSample{
+		{ID: 1, Timestamp: start},
+		{ID: 2, Timestamp: start.Add(5 * time.Minute)},
+		// The clock stepped back two minutes
+		{ID: 3, Timestamp: start.Add(3 * time.Minute)},
+		{ID: 4, Timestamp: start.Add(5 * time.Minute)},
+	}
+
+	orderSamples(samples)
+
+	want := []uint{1, 3, 2, 4}
+	for i, sample := range samples {
+		if sample.ID != want[i] {
+			t.Fatalf("order = %v, want IDs %v", samples, want)
+		}
+	}
+}
+
+func TestForEachIntervalClampsGaps(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	samples := []powerSample{
+		{Timestamp: start},
+		{Timestamp: start.Add(time.Minute)},
+		{Timestamp: start.Add(time.Minute)},
+		{Timestamp: start.Add(time.Hour)},
+	}
+
+	var intervals []time.Duration
+	forEachInterval(samples, 10*time.Minute, func(_, _ powerSample, dt time.Duration) {
+		intervals = append(intervals, dt)
+	})
+
+	// The duplicate timestamp yields nothing and the hour is clamped
+	want := []time.Duration{time.Minute, 10 * time.Minute}
+	if len(intervals) != len(want) || intervals[0] != want[0] || intervals[1] != want[1] {
+		t.Errorf("intervals = %v, want %v", intervals, want)
+	}
+}
+
+func TestProducingDurationWithOutOfOrderReadings(t *testing.T) {
+	d := newTestDatabase(t)
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// Rows in insertion order; after the third the clock stepped back
+	readings := []struct {
+		offset time.Duration
+		power  uint32
+	}{
+		{0, 1000},
+		{5 * time.Minute, 1000},
+		{10 * time.Minute, 0},
+		{2 * time.Minute, 1000},
+		{7 * time.Minute, 1000},
+	}
+	for _, r := range readings {
+		data := &inverter.InverterData{Timestamp: start.Add(r.offset), SerialNumber: "A1", TotalActivePower: r.power, IsOnline: true}
+		if err := d.SaveReading(data); err != nil {
+			t.Fatalf("SaveReading: %v", err)
+		}
+	}
+
+	got, err := d.getProducingDuration(start, start.Add(time.Hour), 100)
+	if err != nil {
+		t.Fatalf("getProducingDuration: %v", err)
+	}
+	// In timestamp order every interval from 0 to 10 minutes starts at a
+	// producing reading; in insertion order it would be 15 minutes
+	if got != 10*time.Minute {
+		t.Errorf("producing duration = %v, want 10m", got)
+	}
+}
+
+func TestGetPowerProfileWithoutBucket(t *testing.T) {
+	d := newTestDatabase(t)
+	day := time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)
+	saveReadings(t, d, "A1", day.Add(-12*time.Hour))
+
+	for _, bucket := range []time.Duration{0, -time.Minute} {
+		avgs, counts, err := d.GetPowerProfile(day, 7, bucket, 1)
+		if err != nil || avgs != nil || counts != nil {
+			t.Errorf("bucket %s: got %v, %v, %v, want an empty profile", bucket, avgs, counts, err)
+		}
+	}
+}
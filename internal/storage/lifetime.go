@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// lifetimeEnergySetting holds the persisted lifetimeEnergy state.
+const lifetimeEnergySetting = "energy.lifetime"
+
+// energyRolloverTolerance is how far (kWh) TotalEnergy may drop below the
+// high water mark before it is treated as a rollover or a replaced inverter
+// rather than a glitch in a single reading.
+const energyRolloverTolerance = 1.0
+
+// lifetimeEnergy tracks the highest TotalEnergy seen from the current
+// counter and the energy accumulated by counters that have since reset.
+type lifetimeEnergy struct {
+	HighWaterMark float64 `json:"high_water_mark"`
+	Offset        float64 `json:"offset"`
+}
+
+// lifetimeTracker caches the persisted lifetimeEnergy state.
+type lifetimeTracker struct {
+	mu    sync.Mutex
+	state *lifetimeEnergy
+}
+
+// TrackLifetimeEnergy folds the inverter's TotalEnergy counter into the
+// persisted lifetime total and returns it. When the counter drops below the
+// high water mark by more than energyRolloverTolerance, the energy counted
+// so far is carried over so the lifetime total keeps growing, and reset is
+// true. A zero total (a failed read) leaves the state untouched.
+func (d *Database) TrackLifetimeEnergy(total float64) (lifetime float64, reset bool, err error) {
+	d.lifetime.mu.Lock()
+	defer d.lifetime.mu.Unlock()
+
+	if d.lifetime.state == nil {
+		var state lifetimeEnergy
+		if _, err := d.GetSetting(lifetimeEnergySetting, &state); err != nil {
+			return 0, false, err
+		}
+		d.lifetime.state = &state
+	}
+	state := *d.lifetime.state
+
+	if total <= 0 {
+		return state.Offset + state.HighWaterMark, false, nil
+	}
+
+	switch {
+	case total < state.HighWaterMark-energyRolloverTolerance:
+		slog.Warn("Total energy dropped, treating it as a counter rollover or inverter replacement",
+			"from_kwh", state.HighWaterMark, "to_kwh", total)
+		state.Offset += state.HighWaterMark
+		state.HighWaterMark = total
+		reset = true
+	case total > state.HighWaterMark:
+		state.HighWaterMark = total
+	default:
+		return state.Offset + state.HighWaterMark, false, nil
+	}
+
+	if err := d.SetSetting(lifetimeEnergySetting, state); err != nil {
+		return 0, false, err
+	}
+	*d.lifetime.state = state
+	return state.Offset + state.HighWaterMark, reset, nil
+}
@@ -3,22 +3,28 @@ package storage
 import (
 	"time"
 
+	"sungrow-monitor/internal/inverter"
+
 	"gorm.io/gorm"
 )
 
 type InverterReading struct {
 	gorm.Model
-	Timestamp time.Time `gorm:"index" json:"timestamp"`
+	// The unique index starts with the timestamp and also serves range
+	// queries.
+	Timestamp time.Time `gorm:"uniqueIndex:idx_readings_timestamp_serial" json:"timestamp"`
 
 	// Device Info
-	SerialNumber   string  `json:"serial_number"`
+	SerialNumber   string  `gorm:"uniqueIndex:idx_readings_timestamp_serial" json:"serial_number"`
 	DeviceTypeCode uint16  `json:"device_type_code"`
 	NominalPower   float64 `json:"nominal_power_kw"`
 	OutputType     string  `json:"output_type"`
 
 	// Energy
-	DailyEnergy float64 `json:"daily_energy_kwh"`
-	TotalEnergy float64 `json:"total_energy_kwh"`
+	DailyEnergy    float64 `json:"daily_energy_kwh"`
+	TotalEnergy    float64 `json:"total_energy_kwh"`
+	LifetimeEnergy float64 `json:"lifetime_energy_kwh"`
+	CounterReset   bool    `json:"counter_reset"`
 
 	// Temperature
 	Temperature float64 `json:"temperature_c"`
@@ -28,17 +34,31 @@ type InverterReading struct {
 	MPPT1Current float64 `json:"mppt1_current_a"`
 	MPPT2Voltage float64 `json:"mppt2_voltage_v"`
 	MPPT2Current float64 `json:"mppt2_current_a"`
+	MPPT1Power   uint32  `json:"mppt1_power_w"`
+	MPPT2Power   uint32  `json:"mppt2_power_w"`
 	TotalDCPower uint32  `json:"total_dc_power_w"`
 
-	// Grid (single phase)
+	// Grid; the per-phase values are only set on three-phase units
 	GridVoltage   float64 `json:"grid_voltage_v"`
 	GridFrequency float64 `json:"grid_frequency_hz"`
 	GridCurrent   float64 `json:"grid_current_a"`
+	GridDirection string  `json:"grid_direction,omitempty"`
+	GridPhases    int     `json:"grid_phases"`
+	LineVoltage   float64 `json:"line_voltage_v,omitempty"`
+	PhaseAVoltage float64 `json:"phase_a_voltage_v,omitempty"`
+	PhaseBVoltage float64 `json:"phase_b_voltage_v,omitempty"`
+	PhaseCVoltage float64 `json:"phase_c_voltage_v,omitempty"`
+	PhaseACurrent float64 `json:"phase_a_current_a,omitempty"`
+	PhaseBCurrent float64 `json:"phase_b_current_a,omitempty"`
+	PhaseCCurrent float64 `json:"phase_c_current_a,omitempty"`
 
 	// Power
-	TotalActivePower uint32  `json:"total_active_power_w"`
-	ReactivePower    int32   `json:"reactive_power_var"`
-	PowerFactor      float64 `json:"power_factor"`
+	TotalActivePower   uint32  `json:"total_active_power_w"`
+	ReactivePower      int32   `json:"reactive_power_var"`
+	ApparentPower      uint32  `json:"apparent_power_va"`
+	PowerFactor        float64 `json:"power_factor"`
+	EfficiencyPercent  float64 `json:"efficiency_percent,omitempty"`
+	UtilizationPercent float64 `json:"utilization_percent,omitempty"`
 
 	// Status
 	RunningState       uint16 `json:"running_state"`
@@ -47,10 +67,148 @@ type InverterReading struct {
 	IsOnline           bool   `json:"is_online"`
 }
 
+// ToInverterData converts a stored reading back into the shape produced by
+// the inverter reader, e.g. to republish history.
+func (r *InverterReading) ToInverterData() *inverter.InverterData {
+	data := &inverter.InverterData{
+		Timestamp:          r.Timestamp,
+		SerialNumber:       r.SerialNumber,
+		DeviceTypeCode:     r.DeviceTypeCode,
+		NominalPower:       r.NominalPower,
+		OutputType:         r.OutputType,
+		DailyEnergy:        r.DailyEnergy,
+		TotalEnergy:        r.TotalEnergy,
+		LifetimeEnergy:     r.LifetimeEnergy,
+		CounterReset:       r.CounterReset,
+		Temperature:        r.Temperature,
+		MPPT1Voltage:       r.MPPT1Voltage,
+		MPPT1Current:       r.MPPT1Current,
+		MPPT2Voltage:       r.MPPT2Voltage,
+		MPPT2Current:       r.MPPT2Current,
+		MPPT1Power:         r.MPPT1Power,
+		MPPT2Power:         r.MPPT2Power,
+		TotalDCPower:       r.TotalDCPower,
+		GridVoltage:        r.GridVoltage,
+		GridFrequency:      r.GridFrequency,
+		GridCurrent:        r.GridCurrent,
+		GridDirection:      r.GridDirection,
+		GridPhases:         r.GridPhases,
+		LineVoltage:        r.LineVoltage,
+		PhaseAVoltage:      r.PhaseAVoltage,
+		PhaseBVoltage:      r.PhaseBVoltage,
+		PhaseCVoltage:      r.PhaseCVoltage,
+		PhaseACurrent:      r.PhaseACurrent,
+		PhaseBCurrent:      r.PhaseBCurrent,
+		PhaseCCurrent:      r.PhaseCCurrent,
+		TotalActivePower:   r.TotalActivePower,
+		ReactivePower:      r.ReactivePower,
+		ApparentPower:      r.ApparentPower,
+		EfficiencyPercent:  r.EfficiencyPercent,
+		UtilizationPercent: r.UtilizationPercent,
+		PowerFactor:        r.PowerFactor,
+		RunningState:       r.RunningState,
+		RunningStateString: r.RunningStateString,
+		FaultCode:          r.FaultCode,
+		IsOnline:           r.IsOnline,
+	}
+	if r.FaultCode != 0 {
+		data.FaultString = inverter.GetFaultString(r.FaultCode)
+	}
+	return data
+}
+
 type DailyStats struct {
 	Date           time.Time `json:"date"`
 	MaxPower       uint32    `json:"max_power_w"`
+	MaxPowerAt     time.Time `json:"max_power_at"`
 	TotalEnergy    float64   `json:"total_energy_kwh"`
 	AvgTemperature float64   `json:"avg_temperature_c"`
 	ReadingsCount  int64     `json:"readings_count"`
+
+	// ProducingMinutes is the time spent above the producing threshold,
+	// a rough proxy for peak sun hours.
+	ProducingMinutes int `json:"producing_minutes"`
+}
+
+// RangeStats summarizes the readings between two instants. Energy is the
+// rise of the daily energy counter within each day of the range, summed.
+type RangeStats struct {
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	MaxPower       uint32    `json:"max_power_w"`
+	MaxPowerAt     time.Time `json:"max_power_at"`
+	MinPower       uint32    `json:"min_power_w"`
+	AvgPower       float64   `json:"avg_power_w"`
+	Energy         float64   `json:"energy_kwh"`
+	AvgTemperature float64   `json:"avg_temperature_c"`
+	ReadingsCount  int64     `json:"readings_count"`
+
+	ProducingMinutes int `json:"producing_minutes"`
+}
+
+// HourlyEnergy is the energy produced during one hour of a day.
+// ReadingsCount shows how much data backs it: an hour the inverter was
+// partly offline has fewer readings, and the energy produced while it was
+// away is counted in the hour of the next reading.
+type HourlyEnergy struct {
+	Hour          time.Time `json:"hour"`
+	Energy        float64   `json:"energy_kwh"`
+	ReadingsCount int64     `json:"readings_count"`
+}
+
+// DayEnergy is the energy produced on one day: the last daily energy
+// counter value stored for it.
+type DayEnergy struct {
+	Date   time.Time `json:"date"`
+	Energy float64   `json:"energy_kwh"`
+}
+
+// MonthlyEnergy is the energy produced in a month. DaysWithData next to
+// DaysInPeriod (days elapsed so far for the current month) shows how much
+// of the month the total covers.
+type MonthlyEnergy struct {
+	Year         int         `json:"year"`
+	Month        int         `json:"month"`
+	Energy       float64     `json:"energy_kwh"`
+	DaysWithData int         `json:"days_with_data"`
+	DaysInPeriod int         `json:"days_in_period"`
+	Days         []DayEnergy `json:"days,omitempty"`
+}
+
+// YearlyEnergy is the energy produced in a year, with each month's share.
+type YearlyEnergy struct {
+	Year         int             `json:"year"`
+	Energy       float64         `json:"energy_kwh"`
+	DaysWithData int             `json:"days_with_data"`
+	DaysInPeriod int             `json:"days_in_period"`
+	Months       []MonthlyEnergy `json:"months"`
+}
+
+// PowerBucket summarizes the readings of one slice of a downsampled range.
+// Buckets without readings are kept with ReadingsCount 0 so that gaps stay
+// visible on a chart.
+type PowerBucket struct {
+	Start         time.Time `json:"start"`
+	AvgPower      float64   `json:"avg_power_w"`
+	MaxPower      uint32    `json:"max_power_w"`
+	ReadingsCount int64     `json:"readings_count"`
+}
+
+// FaultEvent is a period during which the inverter reported a fault code.
+// ClearedAt is nil while the fault is still active.
+type FaultEvent struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Timestamp    time.Time  `gorm:"index" json:"timestamp"`
+	SerialNumber string     `json:"serial_number"`
+	FaultCode    uint16     `json:"fault_code"`
+	FaultString  string     `json:"fault_string"`
+	ClearedAt    *time.Time `gorm:"index" json:"cleared_at"`
+}
+
+// Setting is a persisted runtime preference. Value holds JSON so that any
+// type can be stored under a key.
+type Setting struct {
+	Key       string    `gorm:"primaryKey" json:"key"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,111 @@
+package storage
+
+import "time"
+
+// GetMonthlyEnergy sums the energy of each day of a month, days starting at
+// midnight in loc. Days without readings count as zero and are left out of
+// Days.
+func (d *Database) GetMonthlyEnergy(year, month int, loc *time.Location) (*MonthlyEnergy, error) {
+	from := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 1, 0)
+
+	days, err := d.getDayEnergies(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return newMonthlyEnergy(from, to, days), nil
+}
+
+// GetYearlyEnergy sums the energy of each day of a year, days starting at
+// midnight in loc, with a breakdown per month.
+func (d *Database) GetYearlyEnergy(year int, loc *time.Location) (*YearlyEnergy, error) {
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(1, 0, 0)
+
+	days, err := d.getDayEnergies(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	yearly := &YearlyEnergy{Year: year, DaysInPeriod: daysElapsed(from, to), Months: make([]MonthlyEnergy, 0, 12)}
+	for start := from; start.Before(to); start = start.AddDate(0, 1, 0) {
+		end := start.AddDate(0, 1, 0)
+		var monthDays []DayEnergy
+		for _, day := range days {
+			if !day.Date.Before(start) && day.Date.Before(end) {
+				monthDays = append(monthDays, day)
+			}
+		}
+
+		monthly := newMonthlyEnergy(start, end, monthDays)
+		monthly.Days = nil
+		yearly.Energy += monthly.Energy
+		yearly.DaysWithData += monthly.DaysWithData
+		yearly.Months = append(yearly.Months, *monthly)
+	}
+	return yearly, nil
+}
+
+func newMonthlyEnergy(from, to time.Time, days []DayEnergy) *MonthlyEnergy {
+	monthly := &MonthlyEnergy{
+		Year:         from.Year(),
+		Month:        int(from.Month()),
+		DaysWithData: len(days),
+		DaysInPeriod: daysElapsed(from, to),
+		Days:         days,
+	}
+	for _, day := range days {
+		monthly.Energy += day.Energy
+	}
+	return monthly
+}
+
+// getDayEnergies returns the last daily energy counter value of each day
+// (in from's location) in [from, to) that has readings, oldest first. The readings are
+// streamed so a whole year does not have to fit in memory.
+func (d *Database) getDayEnergies(from, to time.Time) ([]DayEnergy, error) {
+	rows, err := d.db.Model(&InverterReading{}).
+		Select("timestamp, daily_energy").
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Order("timestamp asc").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []DayEnergy{}
+	for rows.Next() {
+		var sample struct {
+			Timestamp   time.Time
+			DailyEnergy float64
+		}
+		if err := d.db.ScanRows(rows, &sample); err != nil {
+			return nil, err
+		}
+
+		local := sample.Timestamp.In(from.Location())
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, from.Location())
+		if n := len(days); n > 0 && days[n-1].Date.Equal(day) {
+			days[n-1].Energy = sample.DailyEnergy
+			continue
+		}
+		days = append(days, DayEnergy{Date: day, Energy: sample.DailyEnergy})
+	}
+	return days, rows.Err()
+}
+
+// daysElapsed counts the days of [from, to) up to and including today.
+func daysElapsed(from, to time.Time) int {
+	now := time.Now().In(from.Location())
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, from.Location())
+	if to.After(tomorrow) {
+		to = tomorrow
+	}
+
+	days := 0
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		days++
+	}
+	return days
+}
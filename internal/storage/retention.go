@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// retentionInterval is how often EnforceRetention deletes old readings.
+	retentionInterval = 24 * time.Hour
+	// vacuumEvery is how many cleanups pass between VACUUMs, which rewrite
+	// the whole file to give the freed pages back to the filesystem.
+	vacuumEvery = 7
+)
+
+// EnforceRetention deletes readings older than keep right away and then
+// daily, until ctx is cancelled, and refreshes the planner statistics.
+// Every vacuumEvery runs the database is vacuumed if anything was deleted
+// since the last time.
+func (d *Database) EnforceRetention(ctx context.Context, keep time.Duration) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	var runs int
+	var pending int64
+	for {
+		deleted, err := d.CleanOldReadings(keep)
+		if err != nil {
+			slog.Error("Retention cleanup failed", "err", err)
+		} else {
+			slog.Info("Retention cleanup finished", "deleted", deleted, "older_than", keep)
+			pending += deleted
+		}
+		if err := d.Analyze(); err != nil {
+			slog.Warn("Failed to analyze database", "err", err)
+		}
+
+		runs++
+		if runs%vacuumEvery == 0 && pending > 0 {
+			start := time.Now()
+			if err := d.Vacuum(); err != nil {
+				slog.Error("Vacuum failed", "err", err)
+			} else {
+				slog.Info("Vacuumed database", "took", time.Since(start).Round(time.Millisecond))
+				pending = 0
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetSetting decodes the JSON value stored under key into dest. It reports
+// false when the key has never been set.
+func (d *Database) GetSetting(key string, dest interface{}) (bool, error) {
+	var setting Setting
+	result := d.db.Where("key = ?", key).First(&setting)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if err := json.Unmarshal([]byte(setting.Value), dest); err != nil {
+		return true, fmt.Errorf("failed to decode setting %q: %w", key, err)
+	}
+	return true, nil
+}
+
+// SetSetting stores value as JSON under key, replacing any previous value.
+func (d *Database) SetSetting(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode setting %q: %w", key, err)
+	}
+	return d.SetSettingRaw(key, raw)
+}
+
+// SetSettingRaw stores an already encoded JSON value under key.
+func (d *Database) SetSettingRaw(key string, raw json.RawMessage) error {
+	if !json.Valid(raw) {
+		return fmt.Errorf("setting %q is not valid JSON", key)
+	}
+	setting := &Setting{Key: key, Value: string(raw)}
+	return d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(setting).Error
+}
+
+// DeleteSetting removes key. Deleting a missing key is not an error.
+func (d *Database) DeleteSetting(key string) error {
+	return d.db.Where("key = ?", key).Delete(&Setting{}).Error
+}
+
+// UpdateSettings applies changes in one transaction: a null value deletes
+// its key, any other value replaces it. Either every change is stored or
+// none is.
+func (d *Database) UpdateSettings(changes map[string]json.RawMessage) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		txd := &Database{db: tx, lifetime: d.lifetime}
+		for key, value := range changes {
+			var err error
+			if string(value) == "null" {
+				err = txd.DeleteSetting(key)
+			} else {
+				err = txd.SetSettingRaw(key, value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetSettingString returns the string stored under key, or def when unset.
+func (d *Database) GetSettingString(key, def string) (string, error) {
+	value := def
+	if _, err := d.GetSetting(key, &value); err != nil {
+		return def, err
+	}
+	return value, nil
+}
+
+// GetSettingFloat returns the number stored under key, or def when unset.
+func (d *Database) GetSettingFloat(key string, def float64) (float64, error) {
+	value := def
+	if _, err := d.GetSetting(key, &value); err != nil {
+		return def, err
+	}
+	return value, nil
+}
+
+// GetSettingBool returns the boolean stored under key, or def when unset.
+func (d *Database) GetSettingBool(key string, def bool) (bool, error) {
+	value := def
+	if _, err := d.GetSetting(key, &value); err != nil {
+		return def, err
+	}
+	return value, nil
+}
+
+// GetAllSettings returns every stored setting as raw JSON keyed by name.
+func (d *Database) GetAllSettings() (map[string]json.RawMessage, error) {
+	var settings []Setting
+	if err := d.db.Order("key").Find(&settings).Error; err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]json.RawMessage, len(settings))
+	for _, setting := range settings {
+		values[setting.Key] = json.RawMessage(setting.Value)
+	}
+	return values, nil
+}
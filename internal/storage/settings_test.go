@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUpdateSettingsIsAllOrNothing(t *testing.T) {
+	d := newTestDatabase(t)
+	if err := d.SetSetting("theme", "dark"); err != nil {
+		t.Fatalf("SetSetting: %v", err)
+	}
+
+	err := d.UpdateSettings(map[string]json.RawMessage{
+		"theme":  json.RawMessage("null"),
+		"units":  json.RawMessage(`"kw"`),
+		"broken": json.RawMessage(`{`),
+	})
+	if err == nil {
+		t.Fatal("UpdateSettings with an invalid value succeeded")
+	}
+
+	settings, err := d.GetAllSettings()
+	if err != nil {
+		t.Fatalf("GetAllSettings: %v", err)
+	}
+	if len(settings) != 1 || string(settings["theme"]) != `"dark"` {
+		t.Errorf("settings = %v, want only theme unchanged", settings)
+	}
+
+	if err := d.UpdateSettings(map[string]json.RawMessage{"theme": json.RawMessage("null"), "units": json.RawMessage(`"kw"`)}); err != nil {
+		t.Fatalf("UpdateSettings: %v", err)
+	}
+	settings, _ = d.GetAllSettings()
+	if len(settings) != 1 || string(settings["units"]) != `"kw"` {
+		t.Errorf("settings = %v, want only units", settings)
+	}
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+
+	"sungrow-monitor/internal/events"
+)
+
+// StoreReadings saves every reading published on sub, and the fault events
+// they start or end, until ctx is cancelled.
+func (d *Database) StoreReadings(ctx context.Context, sub *events.Subscription) {
+	events.Consume(ctx, sub, func(event events.Event) {
+		reading, ok := event.(events.ReadingEvent)
+		if !ok {
+			return
+		}
+		if err := d.SaveReading(reading.Data); err != nil {
+			slog.Error("Error saving reading", "err", err)
+		}
+		if err := d.TrackFault(reading.Data); err != nil {
+			slog.Error("Error recording fault event", "err", err)
+		}
+	})
+}
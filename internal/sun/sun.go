@@ -0,0 +1,74 @@
+// Package sun computes sunrise and sunset for the installation site, so
+// night-time can be told apart from an inverter that stopped producing.
+package sun
+
+import (
+	"math"
+	"time"
+)
+
+// Site is where the panels are, in decimal degrees (east and north
+// positive).
+type Site struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// julianUnixEpoch is the Julian date of 1970-01-01T00:00:00Z, and j2000 that
+// of 2000-01-01T12:00:00Z.
+const (
+	julianUnixEpoch = 2440587.5
+	j2000           = 2451545.0
+)
+
+func toJulian(t time.Time) float64 {
+	return float64(t.Unix())/86400 + julianUnixEpoch
+}
+
+func fromJulian(j float64, loc *time.Location) time.Time {
+	return time.Unix(0, int64((j-julianUnixEpoch)*86400*float64(time.Second))).In(loc)
+}
+
+func sin(deg float64) float64 { return math.Sin(deg * math.Pi / 180) }
+func cos(deg float64) float64 { return math.Cos(deg * math.Pi / 180) }
+
+// hourAngle returns the solar transit of the day of t as a Julian date and
+// the cosine of the sunrise hour angle, following the sunrise equation.
+// The cosine is above 1 during polar night and below -1 during polar day.
+func (s Site) hourAngle(t time.Time) (transit, cosOmega float64) {
+	noon := time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, t.Location())
+	n := math.Round(toJulian(noon) - j2000 + 0.0008)
+	meanSolarTime := n - s.Longitude/360
+
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	center := 1.9148*sin(anomaly) + 0.02*sin(2*anomaly) + 0.0003*sin(3*anomaly)
+	longitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit = j2000 + meanSolarTime + 0.0053*sin(anomaly) - 0.0069*sin(2*longitude)
+
+	sinDeclination := sin(longitude) * sin(23.4397)
+	cosDeclination := math.Cos(math.Asin(sinDeclination))
+	// -0.833° accounts for refraction and the sun's apparent radius
+	cosOmega = (sin(-0.833) - sin(s.Latitude)*sinDeclination) / (cos(s.Latitude) * cosDeclination)
+	return transit, cosOmega
+}
+
+// Times returns sunrise and sunset on the day of t, in t's location. ok is
+// false when the sun does not rise or does not set that day.
+func (s Site) Times(t time.Time) (sunrise, sunset time.Time, ok bool) {
+	transit, cosOmega := s.hourAngle(t)
+	if cosOmega < -1 || cosOmega > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	omega := math.Acos(cosOmega) * 180 / math.Pi
+	return fromJulian(transit-omega/360, t.Location()), fromJulian(transit+omega/360, t.Location()), true
+}
+
+// IsDaylight reports whether the sun is up at t.
+func (s Site) IsDaylight(t time.Time) bool {
+	sunrise, sunset, ok := s.Times(t)
+	if !ok {
+		_, cosOmega := s.hourAngle(t)
+		return cosOmega < -1
+	}
+	return !t.Before(sunrise) && t.Before(sunset)
+}
@@ -2,6 +2,20 @@
 
 const API_BASE = '/api/v1';
 const UPDATE_INTERVAL = 5000; // 5 seconds
+const RECONNECT_DELAY = 10000; // 10 seconds
+
+// With api.auth_token set, open the dashboard once as /?token=<token>; the
+// token is remembered in this browser and sent with every API call
+const params = new URLSearchParams(location.search);
+if (params.has('token')) {
+    localStorage.setItem('apiToken', params.get('token'));
+}
+const API_TOKEN = localStorage.getItem('apiToken');
+
+function apiFetch(path) {
+    const headers = API_TOKEN ? { Authorization: `Bearer ${API_TOKEN}` } : {};
+    return fetch(`${API_BASE}${path}`, { headers });
+}
 
 // DOM Elements
 const elements = {
@@ -21,6 +35,9 @@ const elements = {
     gridFrequency: document.getElementById('grid-frequency'),
     gridCurrent: document.getElementById('grid-current'),
     powerFactor: document.getElementById('power-factor'),
+    reactivePower: document.getElementById('reactive-power'),
+    gridPhases: document.getElementById('grid-phases'),
+    lineVoltage: document.getElementById('line-voltage'),
     runningState: document.getElementById('running-state'),
     temperature: document.getElementById('temperature'),
     serialNumber: document.getElementById('serial-number'),
@@ -33,13 +50,13 @@ const NOMINAL_POWER = 5000;
 // Fetch data from API
 async function fetchStatus() {
     try {
-        const response = await fetch(`${API_BASE}/status`);
+        const response = await apiFetch('/status');
         if (!response.ok) {
             throw new Error(`HTTP error! status: ${response.status}`);
         }
         const data = await response.json();
         updateDashboard(data);
-        setOnlineStatus(data.is_online === true);
+        setOnlineStatus(data.is_online === true, data.is_asleep === true);
     } catch (error) {
         console.error('Error fetching status:', error);
         setOnlineStatus(false);
@@ -61,23 +78,36 @@ function updateDashboard(data) {
     // MPPT 1
     elements.mppt1Voltage.textContent = formatNumber(data.mppt1_voltage_v, 1);
     elements.mppt1Current.textContent = formatNumber(data.mppt1_current_a, 2);
-    const mppt1Power = (data.mppt1_voltage_v || 0) * (data.mppt1_current_a || 0);
-    elements.mppt1Power.textContent = formatNumber(mppt1Power, 0);
+    elements.mppt1Power.textContent = formatNumber(data.mppt1_power_w, 0);
 
     // MPPT 2
     elements.mppt2Voltage.textContent = formatNumber(data.mppt2_voltage_v, 1);
     elements.mppt2Current.textContent = formatNumber(data.mppt2_current_a, 2);
-    const mppt2Power = (data.mppt2_voltage_v || 0) * (data.mppt2_current_a || 0);
-    elements.mppt2Power.textContent = formatNumber(mppt2Power, 0);
+    elements.mppt2Power.textContent = formatNumber(data.mppt2_power_w, 0);
 
     // Grid
     elements.gridVoltage.textContent = formatNumber(data.grid_voltage_v, 1);
     elements.gridFrequency.textContent = formatNumber(data.grid_frequency_hz, 1);
     elements.gridCurrent.textContent = formatNumber(data.grid_current_a, 2);
     elements.powerFactor.textContent = formatNumber(data.power_factor, 3);
+    elements.reactivePower.textContent = formatNumber(data.reactive_power_var, 0);
+
+    // Three-phase grid
+    const threePhase = data.grid_phases === 3;
+    elements.gridPhases.hidden = !threePhase;
+    if (threePhase) {
+        for (const phase of ['a', 'b', 'c']) {
+            document.getElementById(`phase-${phase}-voltage`).textContent = formatNumber(data[`phase_${phase}_voltage_v`], 1);
+            document.getElementById(`phase-${phase}-current`).textContent = formatNumber(data[`phase_${phase}_current_a`], 2);
+        }
+        elements.lineVoltage.textContent = formatNumber(data.line_voltage_v, 1);
+    }
 
     // Status
     elements.runningState.textContent = data.running_state_string || '--';
+    if (data.fault_string) {
+        elements.runningState.textContent += ` (${data.fault_string})`;
+    }
     elements.temperature.textContent = formatNumber(data.temperature_c, 1);
     elements.serialNumber.textContent = data.serial_number || '--';
 
@@ -88,8 +118,8 @@ function updateDashboard(data) {
     }
 }
 
-// Set online/offline status
-function setOnlineStatus(online) {
+// Set online/offline status; an asleep inverter is offline for the night
+function setOnlineStatus(online, asleep = false) {
     if (online) {
         elements.statusDot.classList.remove('offline');
         elements.statusDot.classList.add('online');
@@ -97,7 +127,7 @@ function setOnlineStatus(online) {
     } else {
         elements.statusDot.classList.remove('online');
         elements.statusDot.classList.add('offline');
-        elements.statusText.textContent = 'Offline';
+        elements.statusText.textContent = asleep ? 'Em repouso' : 'Offline';
     }
 }
 
@@ -109,11 +139,40 @@ function formatNumber(value, decimals = 0) {
     return Number(value).toFixed(decimals);
 }
 
+// Live updates arrive over a WebSocket after each poll; while it is down
+// the dashboard falls back to polling /status
+let liveSocket = null;
+
+function connectLive() {
+    const protocol = location.protocol === 'https:' ? 'wss' : 'ws';
+    const query = API_TOKEN ? `?token=${encodeURIComponent(API_TOKEN)}` : '';
+    const socket = new WebSocket(`${protocol}://${location.host}${API_BASE}/ws${query}`);
+    socket.onopen = () => {
+        liveSocket = socket;
+    };
+    socket.onmessage = (message) => {
+        const data = JSON.parse(message.data);
+        updateDashboard(data);
+        setOnlineStatus(data.is_online === true, data.is_asleep === true);
+    };
+    socket.onclose = () => {
+        liveSocket = null;
+        setTimeout(connectLive, RECONNECT_DELAY);
+    };
+}
+
 // Initial fetch
 fetchStatus();
+if ('WebSocket' in window) {
+    connectLive();
+}
 
-// Set up interval for updates
-setInterval(fetchStatus, UPDATE_INTERVAL);
+// Poll only while there is no live connection
+setInterval(() => {
+    if (!liveSocket) {
+        fetchStatus();
+    }
+}, UPDATE_INTERVAL);
 
 // Health check
 async function checkHealth() {